@@ -0,0 +1,619 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/dyrkin/rezerwacje-duw-go/captcha"
+	"github.com/dyrkin/rezerwacje-duw-go/cmd"
+	"github.com/dyrkin/rezerwacje-duw-go/config"
+	"github.com/dyrkin/rezerwacje-duw-go/log"
+	"github.com/dyrkin/rezerwacje-duw-go/queue"
+	"github.com/dyrkin/rezerwacje-duw-go/session"
+)
+
+//booking makes reservation for one account. It owns its session, cookies, reservation queue and lock,
+//so several accounts can be served by one process without interfering
+type booking struct {
+	name             string
+	shared           bool
+	userConf         *config.UserConfig
+	client           *session.Session
+	jar              *session.PersistentJar
+	reservationQueue *queue.ReservationQueue
+	mutex            *sync.Mutex
+	solver           captcha.Solver
+	//archive keeps solved captchas. It is nil if archiving is disabled
+	archive *captcha.Archive
+}
+
+//newBooking creates booking for the account described in the given user file.
+//Shared booking keeps its cookies and cassettes apart from the other accounts
+func newBooking(userFile string, shared bool, solver captcha.Solver, archive *captcha.Archive) *booking {
+	name := strings.TrimSuffix(filepath.Base(userFile), filepath.Ext(userFile))
+	return &booking{
+		name:             name,
+		shared:           shared,
+		userConf:         config.UserConfFrom(userFile),
+		client:           newClient(),
+		reservationQueue: queue.NewWithLimit(5),
+		mutex:            &sync.Mutex{},
+		solver:           solver,
+		archive:          archive,
+	}
+}
+
+func (b *booking) infof(format string, v ...interface{}) {
+	if b.shared {
+		format = "[" + b.name + "] " + format
+	}
+	log.Infof(format, v...)
+}
+
+//accountPath makes the path of a file or directory unique for the account if the process serves several accounts
+func (b *booking) accountPath(path string) string {
+	if !b.shared {
+		return path
+	}
+	extension := filepath.Ext(path)
+	return strings.TrimSuffix(path, extension) + "-" + b.name + extension
+}
+
+func (b *booking) acceptTerms(ctx context.Context, entity *config.Entity) error {
+	url := u(fmt.Sprintf("/opmenus/terms/%s/%s?accepted=true", entity.Queue, entity.ID))
+	acceptTermsRequest := session.Get(url).Endpoint(termsEndpoint).Timeout(timeout(termsEndpoint))
+	response, err := b.client.SafeSendContext(ctx, acceptTermsRequest)
+	if err != nil {
+		return err
+	}
+	response.Drain()
+	return nil
+}
+
+func (b *booking) latestDate(ctx context.Context, entity *config.Entity) (string, error) {
+	if err := b.acceptTerms(ctx, entity); err != nil {
+		return "", err
+	}
+	url := u(fmt.Sprintf("/pol/queues/%s/%s", entity.Queue, entity.ID))
+	entityRequest := session.Get(url).Endpoint(termsEndpoint).Timeout(timeout(termsEndpoint))
+	response, err := b.client.SafeSendContext(ctx, entityRequest)
+	if err != nil {
+		return "", err
+	}
+	entityHTML, err := response.Text()
+	if err != nil {
+		return "", err
+	}
+	return extractLatestDate(entityHTML)
+}
+
+func (b *booking) terms(ctx context.Context, entity *config.Entity, date string) []string {
+	url := u(fmt.Sprintf("/pol/queues/%s/%s/%s", entity.Queue, entity.ID, date))
+	headers := session.Headers{"X-Requested-With": "XMLHttpRequest"}
+	termsRequest := session.Get(url).Headers(headers).Endpoint(termsEndpoint).Timeout(timeout(termsEndpoint))
+	response, err := b.client.SafeSendContext(ctx, termsRequest)
+	if err != nil {
+		b.infof("Unable to get terms for %q: %s", entity.Name, err)
+		return []string{}
+	}
+	termsHTML, err := response.Text()
+	if err == session.ErrEmptyBody {
+		termsHTML, err = "", nil
+	}
+	if err != nil {
+		b.infof("Unable to get terms for %q: %s", entity.Name, err)
+		return []string{}
+	}
+	terms := extractTerms(termsHTML)
+	b.infof("Available terms for %q: %q", entity.Name, terms)
+	return terms
+}
+
+//solution is the captcha and its recognized text
+type solution struct {
+	image      []byte
+	text       string
+	confidence float64
+}
+
+//recognizeCaptcha solves captchas until the solvers are sure of the answer or the attempts are exhausted,
+//then the last answer is used anyway
+func (b *booking) recognizeCaptcha(ctx context.Context) (*solution, error) {
+	attempts := applicationConf.Captcha.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	for attempt := 1; ; attempt++ {
+		captchaRequest := session.Get(u("/captcha")).Endpoint(captchaEndpoint).Timeout(timeout(captchaEndpoint))
+		response, err := b.client.SafeSendContext(ctx, captchaRequest)
+		if err != nil {
+			return nil, err
+		}
+		captchaImage, err := response.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		text, confidence, err := b.solver.Solve(ctx, captchaImage)
+		solved := &solution{image: captchaImage, text: text, confidence: confidence}
+		if err == captcha.ErrNotConfident && attempt < attempts {
+			b.infof("Captcha recognized as %q is unsure with confidence %.2f. Fetching a fresh one", text, confidence)
+			b.archiveCaptcha(solved, captcha.Unchecked)
+			continue
+		}
+		if err == captcha.ErrNotConfident && text != "" {
+			b.infof("Captcha recognized as %q is unsure with confidence %.2f, but there are no attempts left", text, confidence)
+			return solved, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		b.infof("Captcha is recognized as %q with confidence %.2f", text, confidence)
+		return solved, nil
+	}
+}
+
+//archiveCaptcha keeps the captcha for labelling if the archive is enabled
+func (b *booking) archiveCaptcha(solved *solution, status string) {
+	if b.archive == nil {
+		return
+	}
+	if err := b.archive.Save(solved.image, solved.text, solved.confidence, status); err != nil {
+		b.infof("Unable to archive captcha: %s", err)
+	}
+}
+
+func (b *booking) checkCaptcha(ctx context.Context, captcha string) (bool, error) {
+	body := url.Values{"code": {captcha}}
+	checkCaptchaRequest := session.Post(u("/captcha/check")).Form(body).Endpoint(captchaEndpoint).Timeout(timeout(captchaEndpoint))
+	response, err := b.client.SafeSendContext(ctx, checkCaptchaRequest)
+	if err != nil {
+		return false, err
+	}
+	answer, err := response.Text()
+	if err != nil {
+		return false, err
+	}
+	return answer == "true", nil
+}
+
+func (b *booking) postUserData(ctx context.Context, entity *config.Entity, slot string, userData *[]*config.Row) error {
+	url := u(fmt.Sprintf("/reservations/updateFormData/%s/%s", slot, entity.ID))
+	postUserDataRequest := session.Post(url).JSON(*userData).Endpoint(reservationEndpoint).Timeout(timeout(reservationEndpoint))
+	response, err := b.client.SafeSendContext(ctx, postUserDataRequest)
+	if err != nil {
+		return err
+	}
+	response.Drain()
+	return nil
+}
+
+func (b *booking) confirmTerm(ctx context.Context, entity *config.Entity, slot string) error {
+	url := u(fmt.Sprintf("/reservations/reserv/%s/%s", slot, entity.ID))
+	confirmTermRequest := session.Get(url).Endpoint(reservationEndpoint).Timeout(timeout(reservationEndpoint))
+	response, err := b.client.SafeSendContext(ctx, confirmTermRequest)
+	if err != nil {
+		return err
+	}
+	response.Drain()
+	return nil
+}
+
+func (b *booking) reserve(ctx context.Context, entity *config.Entity, time string, slot string, userData *[]*config.Row) bool {
+	b.infof("Attempt to make reservation for %q, slot %q and time %q", entity.Name, slot, time)
+	recognizedCaptcha, err := b.recognizeCaptcha(ctx)
+	if err != nil {
+		b.infof("Unable to get captcha for %q, slot %q and time %q: %s", entity.Name, slot, time, err)
+		b.mutex.Unlock()
+		return false
+	}
+	if ok, err := b.checkCaptcha(ctx, recognizedCaptcha.text); !ok {
+		if err != nil {
+			b.infof("Unable to check captcha for %q, slot %q and time %q: %s", entity.Name, slot, time, err)
+			b.archiveCaptcha(recognizedCaptcha, captcha.Unchecked)
+		} else {
+			b.archiveCaptcha(recognizedCaptcha, captcha.Rejected)
+		}
+		b.mutex.Unlock()
+		return false
+	}
+	b.archiveCaptcha(recognizedCaptcha, captcha.Accepted)
+	b.infof("Captcha submitted successfully. Making reservation for %q, slot %q and time %q", entity.Name, slot, time)
+	if err := b.postUserData(ctx, entity, slot, userData); err != nil {
+		b.infof("Unable to post user data for %q, slot %q and time %q: %s", entity.Name, slot, time, err)
+		b.mutex.Unlock()
+		return false
+	}
+	b.infof("User data posted for %q, slot %q and time %q", entity.Name, slot, time)
+	if err := b.confirmTerm(ctx, entity, slot); err != nil {
+		b.infof("Unable to confirm reservation for %q, slot %q and time %q: %s", entity.Name, slot, time, err)
+		b.mutex.Unlock()
+		return false
+	}
+	b.infof("Reservation completed for %q, slot %q and time %q. Check your email or DUW site", entity.Name, slot, time)
+	return true
+}
+
+type lockResult struct {
+	answer string
+	err    error
+}
+
+//tryLock sends several lock requests at once and returns the first answer of the portal.
+//Returns an error only if none of the requests got an answer
+func (b *booking) tryLock(ctx context.Context, entity *config.Entity, time string) (string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	lockResults := make(chan lockResult, 5)
+	for i := 0; i < 5; i++ {
+		go func() {
+			body := url.Values{"time": {time}, "queue": {entity.Queue}}
+			lockRequest := session.Post(u("/reservations/lock")).Form(body).Endpoint(lockEndpoint).Timeout(timeout(lockEndpoint))
+			response, err := b.client.SafeSendContext(ctx, lockRequest)
+			if err != nil {
+				lockResults <- lockResult{err: err}
+				return
+			}
+			answer, err := response.Text()
+			lockResults <- lockResult{answer, err}
+		}()
+	}
+	var err error
+	for i := 0; i < 5; i++ {
+		result := <-lockResults
+		if result.err == nil {
+			return result.answer, nil
+		}
+		err = result.err
+	}
+	return "", err
+}
+
+//lockAnswer is the parsed answer of the lock request
+type lockAnswer struct {
+	locked bool
+	slot   string
+}
+
+//parseLockAnswer reads the answer of the lock request. The term is locked only if the answer is "OK", a separator and
+//a slot, anything else, like an error page, means it is not locked
+func parseLockAnswer(answer string) lockAnswer {
+	if !strings.HasPrefix(answer, "OK") || len(answer) < 4 {
+		return lockAnswer{}
+	}
+	if separator := rune(answer[2]); unicode.IsLetter(separator) || unicode.IsDigit(separator) {
+		return lockAnswer{}
+	}
+	slot := strings.TrimSpace(answer[3:])
+	if slot == "" {
+		return lockAnswer{}
+	}
+	return lockAnswer{locked: true, slot: slot}
+}
+
+func (b *booking) lock(ctx context.Context, entity *config.Entity, time string) (slot string, locked bool) {
+	b.mutex.Lock()
+	b.infof("Locking term %s for %q", time, entity.Name)
+	lockResult, err := b.tryLock(ctx, entity, time)
+	if err != nil {
+		b.infof("Unable to lock term %q for %q: %s", time, entity.Name, err)
+		b.mutex.Unlock()
+		return "", false
+	}
+	if answer := parseLockAnswer(lockResult); answer.locked {
+		b.infof("Term is locked. %q, time %q, slot %q", entity.Name, time, answer.slot)
+		return answer.slot, true
+	}
+	b.infof("Unable to lock term %q for %q. Reason %q", time, entity.Name, lockResult)
+	b.mutex.Unlock()
+	return "", false
+}
+
+func (b *booking) initQueueProcessor(ctx context.Context, reserved context.CancelFunc) {
+	go b.processQueue(ctx, reserved)
+}
+
+//processQueue reserves queued terms one by one until the context is done
+func (b *booking) processQueue(ctx context.Context, reserved context.CancelFunc) {
+	for ctx.Err() == nil {
+		reservation := b.reservationQueue.Take(ctx)
+		if reservation == nil {
+			return
+		}
+		time := fmt.Sprintf("%s %s:00", reservation.Date, reservation.Term)
+		reservationCtx := session.WithStickyProxy(ctx)
+		if slot, ok := b.lock(reservationCtx, reservation.Entity, time); ok {
+			if b.reserve(reservationCtx, reservation.Entity, time, slot, reservation.UserData) {
+				reserved()
+			}
+		}
+	}
+}
+
+func (b *booking) scheduleReservation(entity *config.Entity, date string, term string, userData *[]*config.Row) {
+	reservation := &queue.Reservation{Entity: entity, Date: date, Term: term, UserData: userData}
+	b.reservationQueue.Push(reservation)
+}
+
+func (b *booking) process(ctx context.Context, entity config.Entity, date string, userData *[]*config.Row) {
+	for ctx.Err() == nil {
+		b.infof("Scanning terms for %q and date %q", entity.Name, date)
+		terms := b.terms(ctx, &entity, date)
+		for _, term := range terms {
+			b.scheduleReservation(&entity, date, term, userData)
+		}
+	}
+}
+
+func (b *booking) setUpTrace() error {
+	trace := applicationConf.Trace
+	rules := session.DefaultTrace()
+	rules.Headers = append(rules.Headers, trace.Headers...)
+	rules.FormFields = append(rules.FormFields, trace.FormFields...)
+	rules.JSONKeys = append(rules.JSONKeys, trace.JSONKeys...)
+	switch trace.Mode {
+	case "", "bodies":
+	case "headers":
+		rules.Bodies = false
+	case "off":
+		rules = nil
+	default:
+		return fmt.Errorf("Unknown trace mode [%s]", trace.Mode)
+	}
+	b.client.SetTrace(rules)
+	return nil
+}
+
+func (b *booking) setUpVCR() error {
+	vcr := applicationConf.VCR
+	cassettes := b.accountPath(vcr.Cassettes)
+	switch vcr.Mode {
+	case "":
+		return nil
+	case "record":
+		b.infof("Recording portal traffic to %q", cassettes)
+		return b.client.Record(cassettes)
+	case "replay":
+		b.infof("Replaying portal traffic from %q", cassettes)
+		return b.client.Replay(cassettes)
+	}
+	return fmt.Errorf("Unknown vcr mode [%s]", vcr.Mode)
+}
+
+//restoreCookies makes the session use cookies persisted by previous runs.
+//Does nothing if cookies persistence is disabled or cookies can't be restored
+func (b *booking) restoreCookies(ctx context.Context) {
+	cookies := applicationConf.Cookies
+	if cookies.File == "" {
+		return
+	}
+	file := b.accountPath(cookies.File)
+	jar, err := session.LoadJar(file)
+	if err != nil {
+		b.infof("Unable to restore cookies from %q: %s", file, err)
+		return
+	}
+	b.jar = jar
+	b.client.SetJar(jar)
+	if cookies.SaveInterval.Duration > 0 {
+		go jar.SaveEvery(ctx, cookies.SaveInterval.Duration)
+	}
+}
+
+func (b *booking) saveCookies() {
+	if b.jar == nil {
+		return
+	}
+	if err := b.jar.Save(); err != nil {
+		b.infof("Unable to save cookies: %s", err)
+	}
+}
+
+//authenticated checks whether the session is logged in.
+//Login page redirects logged in users away and shows the login form to anonymous ones
+func (b *booking) authenticated(ctx context.Context) (bool, error) {
+	loginPageRequest := session.Get(u("/pol/login")).Endpoint(loginEndpoint).Timeout(timeout(loginEndpoint))
+	loginPageResponse, err := b.client.SafeSendContext(session.WithoutReauthentication(ctx), loginPageRequest)
+	if err != nil {
+		return false, err
+	}
+	return loginPageResponse.Drain().Response.StatusCode == 302, nil
+}
+
+//authenticate reuses restored session if it is still logged in and logs in otherwise
+func (b *booking) authenticate(ctx context.Context) (bool, error) {
+	if b.jar != nil {
+		b.infof("Checking restored session...")
+		if ok, err := b.authenticated(ctx); ok {
+			b.infof("Restored session is still valid")
+			return true, nil
+		} else if err != nil {
+			b.infof("Unable to check restored session: %s", err)
+		}
+	}
+	b.infof("Logging in...")
+	loggedIn, err := b.login(ctx)
+	if loggedIn {
+		b.saveCookies()
+	}
+	return loggedIn, err
+}
+
+//enableReauthentication makes the session log in again once the portal session expires during scanning
+func (b *booking) enableReauthentication() {
+	b.client.SetReauthentication(&session.Reauthentication{
+		LoginPath: "/pol/login",
+		Markers:   []string{"data[User][password]"},
+		Login: func(ctx context.Context) error {
+			loggedIn, err := b.login(ctx)
+			if err != nil {
+				return err
+			}
+			if !loggedIn {
+				return fmt.Errorf("Invalid login or password")
+			}
+			b.infof("Successfully logged in again")
+			b.saveCookies()
+			return nil
+		},
+	})
+}
+
+func (b *booking) login(ctx context.Context) (bool, error) {
+	body := url.Values{"data[User][email]": {b.userConf.Login}, "data[User][password]": {b.userConf.Password}}
+	loginRequest := session.Post(u("/pol/login")).Form(body).Endpoint(loginEndpoint).Timeout(timeout(loginEndpoint))
+	loginResponse, err := b.client.SafeSendContext(ctx, loginRequest)
+	if err != nil {
+		return false, err
+	}
+	return loginResponse.Drain().Response.StatusCode != 200, nil
+}
+
+func (b *booking) collectActiveEntities(ctx context.Context, entities []*config.Entity, validation func(date string) (time.Weekday, bool), failMessage string) map[*config.Entity]string {
+	entitiesToProcess := map[*config.Entity]string{}
+	for _, entity := range entities {
+		entityDate, err := b.latestDate(ctx, entity)
+		if err != nil {
+			b.infof("Unable to get latest date for %q: %s", entity.Name, err)
+			continue
+		}
+		b.infof("Validating current latest date %q for %q", entityDate, entity.Name)
+		if weekday, ok := validation(entityDate); ok {
+			b.infof("Going to process %q for date %q", entity.Name, entityDate)
+			entitiesToProcess[entity] = entityDate
+		} else {
+			b.infof(failMessage, entityDate, weekday, entity.Name)
+		}
+	}
+	return entitiesToProcess
+}
+
+func (b *booking) collectActiveDepartments(ctx context.Context, enabledDepartment string) map[*config.Entity]string {
+	if department, ok := findEntity(applicationConf.Departments, enabledDepartment); ok {
+		departments := []*config.Entity{department}
+		return b.collectActiveEntities(ctx, departments, validDepartmentDate,
+			"Date %q(%q) is wrong for %q because it is not Tuesday or Thursday")
+	}
+	panic(fmt.Sprintf("Unsupported department [%s]", enabledDepartment))
+}
+
+func (b *booking) collectActiveCities(ctx context.Context, enabledCities []string) map[*config.Entity]string {
+	cities := []*config.Entity{}
+	if enabledCities != nil {
+		for _, enabledCity := range enabledCities {
+			if city, ok := findEntity(applicationConf.Cities, enabledCity); ok {
+				cities = append(cities, city)
+			} else {
+				panic(fmt.Sprintf("Unsupported city [%s]", enabledCity))
+			}
+		}
+	} else {
+		cities = applicationConf.Cities
+	}
+	return b.collectActiveEntities(ctx, cities, validCityDate,
+		"Date %q(%q) is wrong for %q because it is weekend")
+}
+
+func (b *booking) processEntities(ctx context.Context, entities map[*config.Entity]string, userData []*config.Row) {
+	for i := 0; i < applicationConf.ParallelismFactor; i++ {
+		for entity, date := range entities {
+			go b.process(ctx, *entity, date, &userData)
+		}
+	}
+}
+
+//keepConnectionsWarm opens connections to the portal ahead of every warmup time until the context is done
+func (b *booking) keepConnectionsWarm(ctx context.Context) {
+	warmup := applicationConf.Warmup
+	if warmup.Connections <= 0 {
+		return
+	}
+	interval := warmup.Interval.Duration
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	for ctx.Err() == nil {
+		at, ok := nextWarmupTime(time.Now(), warmupTimes, warmup.Lead.Duration)
+		if !ok {
+			return
+		}
+		sleepUntil(ctx, at.Add(-warmup.Lead.Duration))
+		b.client.ForgetWarmConnections()
+		for ctx.Err() == nil && time.Now().Before(at.Add(warmup.Lead.Duration)) {
+			report, err := b.client.Warm(ctx, u("/"), warmup.Connections)
+			if err != nil {
+				b.infof("Unable to warm up connections ahead of %s: %s", at.Format("15:04:05"), err)
+			} else if report.Requests > report.Reused {
+				b.infof("Opened %d connections over %s ahead of %s. Opening a connection takes %s",
+					report.Requests-report.Reused, report.Protocol, at.Format("15:04:05"), report.AverageHandshake())
+			}
+			sleepUntil(ctx, time.Now().Add(interval))
+		}
+		b.reportConnections()
+	}
+}
+
+//reportConnections tells how much latency connections opened ahead of release times saved
+func (b *booking) reportConnections() {
+	stats := b.client.ConnectionStats()
+	if stats.Requests == 0 {
+		return
+	}
+	b.infof("%d of %d requests reused open connections", stats.Reused, stats.Requests)
+	warmup := b.client.WarmupStats()
+	if warmup.Opened == 0 {
+		return
+	}
+	b.infof("%d requests reused %d warmed up connections and saved %s in total, %s each",
+		warmup.Reused, warmup.Opened, warmup.Saved(), warmup.AverageHandshake())
+}
+
+//run logs in and scans terms until the reservation is made or the context is done
+func (b *booking) run(ctx context.Context, command string, args []string) {
+	ctx, reserved := context.WithCancel(ctx)
+	defer reserved()
+	b.client.SetTimeout(timeout(defaultEndpoint))
+	if err := b.setUpTrace(); err != nil {
+		b.infof("Unable to set up trace: %s", err)
+		return
+	}
+	if err := b.setUpVCR(); err != nil {
+		b.infof("Unable to set up vcr: %s", err)
+		return
+	}
+	b.restoreCookies(ctx)
+	defer b.saveCookies()
+	loggedIn, err := b.authenticate(ctx)
+	if err != nil {
+		b.infof("Unable to log in: %s", err)
+		return
+	}
+	if !loggedIn {
+		b.infof("Invalid login or password")
+		return
+	}
+	b.infof("Successfully logged in")
+	b.enableReauthentication()
+	var userData []*config.Row
+	var entities map[*config.Entity]string
+	switch command {
+	case cmd.ApplicationCommand:
+		userData = config.CollectApplicationSubmissionData(b.userConf)
+		enabledCities := args
+		entities = b.collectActiveCities(ctx, enabledCities)
+	case cmd.HeadofCommand:
+		userData = config.CollectHeadOfDepartmentData(b.userConf)
+		enabledDepartment := args[0]
+		entities = b.collectActiveDepartments(ctx, enabledDepartment)
+	}
+	go b.keepConnectionsWarm(ctx)
+	b.initQueueProcessor(ctx, reserved)
+	b.processEntities(ctx, entities, userData)
+	<-ctx.Done()
+	b.reportConnections()
+}
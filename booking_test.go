@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dyrkin/rezerwacje-duw-go/queue"
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type BookingSuite struct{}
+
+var _ = Suite(&BookingSuite{})
+
+func (s *BookingSuite) TestQueueProcessorExits(c *C) {
+	b := &booking{reservationQueue: queue.New()}
+	ctx, cancel := context.WithCancel(context.Background())
+	exited := make(chan struct{})
+	go func() {
+		b.processQueue(ctx, cancel)
+		close(exited)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		c.Fatal("queue processor did not exit")
+	}
+}
+
+func (s *BookingSuite) TestParseLockAnswer(c *C) {
+	c.Assert(parseLockAnswer("OK 123"), Equals, lockAnswer{locked: true, slot: "123"})
+	c.Assert(parseLockAnswer("OK"), Equals, lockAnswer{})
+	c.Assert(parseLockAnswer("OK "), Equals, lockAnswer{})
+	c.Assert(parseLockAnswer("OKAY 123"), Equals, lockAnswer{})
+	c.Assert(parseLockAnswer("<html><body>Internal Server Error</body></html>"), Equals, lockAnswer{})
+}
+
+func (s *BookingSuite) TestNextWarmupTime(c *C) {
+	morning, _ := time.Parse("15:04:05", "07:00:00")
+	afternoon, _ := time.Parse("15:04:05", "15:00:00")
+	times := []time.Time{afternoon, morning}
+	now := time.Date(2024, 10, 1, 7, 0, 30, 0, time.Local)
+
+	next, ok := nextWarmupTime(now, times, time.Minute)
+	c.Assert(ok, Equals, true)
+	c.Assert(next, Equals, time.Date(2024, 10, 1, 7, 0, 0, 0, time.Local))
+	next, _ = nextWarmupTime(now.Add(time.Minute), times, time.Minute)
+	c.Assert(next, Equals, time.Date(2024, 10, 1, 15, 0, 0, 0, time.Local))
+	next, _ = nextWarmupTime(now.Add(9*time.Hour), times, time.Minute)
+	c.Assert(next, Equals, time.Date(2024, 10, 2, 7, 0, 0, 0, time.Local))
+	_, ok = nextWarmupTime(now, nil, time.Minute)
+	c.Assert(ok, Equals, false)
+}
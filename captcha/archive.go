@@ -0,0 +1,128 @@
+package captcha
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+//Statuses of archived captchas
+const (
+	//Accepted captchas were recognized correctly
+	Accepted = "accepted"
+	//Rejected captchas were recognized wrongly
+	Rejected = "rejected"
+	//Unchecked captchas were not checked by the portal, because the solvers were unsure of them or the check failed
+	Unchecked = "unchecked"
+)
+
+//Entry is the archived captcha. It is stored as the image and the JSON file of the same name next to it
+type Entry struct {
+	Image      string
+	Text       string
+	Confidence float64
+	Status     string
+	Time       time.Time
+	//Label is the answer given by a human
+	Label string `json:",omitempty"`
+}
+
+//Archive keeps solved captchas, so that the ones recognized wrongly may be labelled and used for training
+type Archive struct {
+	dir string
+}
+
+//NewArchive creates archive in the directory
+func NewArchive(dir string) (*Archive, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Archive{dir: dir}, nil
+}
+
+//Save stores the captcha with the recognized text, confidence and status
+func (a *Archive) Save(captcha []byte, text string, confidence float64, status string) error {
+	extension := ".img"
+	if _, format, err := image.DecodeConfig(bytes.NewReader(captcha)); err == nil {
+		extension = "." + format
+	}
+	file, err := ioutil.TempFile(a.dir, time.Now().Format("20060102-150405-*")+extension)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(captcha)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	entry := &Entry{Image: filepath.Base(file.Name()), Text: text, Confidence: confidence, Status: status, Time: time.Now()}
+	return a.write(entry)
+}
+
+//Unlabelled returns captchas which were not accepted and were not labelled yet, the oldest first
+func (a *Archive) Unlabelled() ([]*Entry, error) {
+	files, err := filepath.Glob(filepath.Join(a.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	entries := []*Entry{}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		entry := &Entry{}
+		if err := json.Unmarshal(data, entry); err != nil {
+			return nil, fmt.Errorf("unable to read [%s]: %s", file, err)
+		}
+		if entry.Status != Accepted && entry.Label == "" {
+			entries = append(entries, entry)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+	return entries, nil
+}
+
+//Read returns the image of the archived captcha
+func (a *Archive) Read(entry *Entry) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(a.dir, entry.Image))
+}
+
+//Label stores the answer of the captcha and copies it to the training directory named after the answer, see AnswerOf
+func (a *Archive) Label(entry *Entry, answer string, trainingDir string) error {
+	if answer == "" || strings.Trim(answer, "0123456789") != "" {
+		return fmt.Errorf("answer [%s] is not digits", answer)
+	}
+	captcha, err := a.Read(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(trainingDir, 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(trainingDir, answer+"_"+entry.Image), captcha, 0644); err != nil {
+		return err
+	}
+	entry.Label = answer
+	return a.write(entry)
+}
+
+func (a *Archive) write(entry *Entry) error {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(a.dir, strings.TrimSuffix(entry.Image, filepath.Ext(entry.Image))+".json"), data, 0644)
+}
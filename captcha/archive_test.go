@@ -0,0 +1,46 @@
+package captcha
+
+import (
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+type ArchiveSuite struct{}
+
+var _ = Suite(&ArchiveSuite{})
+
+func (s *ArchiveSuite) TestLabelRejectedCaptchas(c *C) {
+	archive, err := NewArchive(filepath.Join(c.MkDir(), "archive"))
+	c.Assert(err, IsNil)
+	c.Assert(archive.Save(synthesize("111111"), "111111", 1, Accepted), IsNil)
+	c.Assert(archive.Save(synthesize("222222"), "222722", 0.9, Rejected), IsNil)
+	c.Assert(archive.Save(synthesize("333333"), "833333", 0.2, Unchecked), IsNil)
+
+	entries, err := archive.Unlabelled()
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 2)
+	c.Assert(entries[0].Text, Equals, "222722")
+	c.Assert(entries[0].Confidence, Equals, 0.9)
+	c.Assert(entries[0].Status, Equals, Rejected)
+	c.Assert(filepath.Ext(entries[0].Image), Equals, ".png")
+	c.Assert(entries[1].Status, Equals, Unchecked)
+
+	training := c.MkDir()
+	c.Assert(archive.Label(entries[0], "22222a", training), ErrorMatches, "answer \\[22222a\\] is not digits")
+	c.Assert(archive.Label(entries[0], "222222", training), IsNil)
+	entries, err = archive.Unlabelled()
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 1)
+	c.Assert(entries[0].Text, Equals, "833333")
+
+	labelled, err := filepath.Glob(filepath.Join(training, "*"))
+	c.Assert(err, IsNil)
+	c.Assert(labelled, HasLen, 1)
+	c.Assert(AnswerOf(labelled[0]), Equals, "222222")
+	trainer := NewTrainer()
+	skipped, err := trainer.TrainDirectory(training)
+	c.Assert(err, IsNil)
+	c.Assert(skipped, HasLen, 0)
+	c.Assert(trainer.Samples()[2], Equals, 6)
+}
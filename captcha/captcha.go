@@ -2,9 +2,13 @@ package captcha
 
 import (
 	"bytes"
+	"fmt"
 	"image"
 	"image/color"
-	"image/png"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
 	"strconv"
 	"strings"
 
@@ -27,75 +31,212 @@ type mutablePalettedImage interface {
 	image.PalettedImage
 }
 
-func decode(imgData []byte) mutablePalettedImage {
-	img, err := png.Decode(bytes.NewReader(imgData))
+//binaryPalette is the palette of decoded captchas and digit templates. Every pixel is either background or ink
+var binaryPalette = color.Palette{color.White, color.Black}
+
+//ink is the palette index of the digit pixels
+const ink = 1
+
+//portalInk is the palette index of the digit pixels in paletted captchas of the portal
+const portalInk = 2
+
+//decode decodes the PNG, JPEG or GIF image and binarizes it. Digits of paletted PNG captchas, like the portal ones,
+//are drawn with portalInk and everything else, even dark noise, is background. Pixels of other images are ink
+//if they are darker than the threshold adapted to the image, so that lighter noise is background
+func decode(imgData []byte) (mutablePalettedImage, error) {
+	img, format, err := image.Decode(bytes.NewReader(imgData))
 	if err != nil {
-		log.Errorf("Unable to decode reader")
+		return nil, fmt.Errorf("captcha is not an image: %s", err)
+	}
+	if paletted, ok := img.(*image.Paletted); ok && format == "png" && len(paletted.Palette) > portalInk {
+		return binarizeInk(paletted, portalInk), nil
+	}
+	return binarizeThreshold(img), nil
+}
+
+//binarizeInk keeps pixels of the ink palette index as ink
+func binarizeInk(img *image.Paletted, inkIndex uint8) *image.Paletted {
+	bounds := img.Bounds()
+	binary := image.NewPaletted(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), binaryPalette)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if img.ColorIndexAt(x, y) == inkIndex {
+				binary.SetColorIndex(x-bounds.Min.X, y-bounds.Min.Y, ink)
+			}
+		}
+	}
+	return binary
+}
+
+//binarizeThreshold keeps pixels darker than the Otsu threshold of the image as ink
+func binarizeThreshold(img image.Image) *image.Paletted {
+	bounds := img.Bounds()
+	gray := make([]uint8, bounds.Dx()*bounds.Dy())
+	histogram := [256]int{}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			level := grayLevel(img.At(x, y))
+			gray[(y-bounds.Min.Y)*bounds.Dx()+x-bounds.Min.X] = level
+			histogram[level]++
+		}
+	}
+	threshold := otsuThreshold(histogram)
+	binary := image.NewPaletted(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), binaryPalette)
+	for i, level := range gray {
+		if level < threshold {
+			binary.Pix[i] = ink
+		}
+	}
+	return binary
+}
+
+//grayLevel returns brightness of the colour as if it was drawn on white background
+func grayLevel(c color.Color) uint8 {
+	r, g, b, a := c.RGBA()
+	background := 0xffff - a
+	return color.GrayModel.Convert(color.RGBA64{R: uint16(r + background), G: uint16(g + background), B: uint16(b + background), A: 0xffff}).(color.Gray).Y
+}
+
+//otsuThreshold returns the gray level which splits pixels of the histogram into dark and light ones
+//so that the variance between the two classes is the largest. Levels below the threshold are dark
+func otsuThreshold(histogram [256]int) uint8 {
+	total, sum := 0, 0
+	for level, count := range histogram {
+		total += count
+		sum += level * count
+	}
+	best, threshold := 0.0, 0
+	dark, darkSum := 0, 0
+	for level := 0; level < 255; level++ {
+		dark += histogram[level]
+		darkSum += level * histogram[level]
+		light := total - dark
+		if dark == 0 || light == 0 {
+			continue
+		}
+		darkMean := float64(darkSum) / float64(dark)
+		lightMean := float64(sum-darkSum) / float64(light)
+		variance := float64(dark) * float64(light) * (darkMean - lightMean) * (darkMean - lightMean)
+		if variance > best {
+			best, threshold = variance, level+1
+		}
 	}
-	return img.(mutablePalettedImage)
+	return uint8(threshold)
 }
 
 func preloadReferenceDigits() []mutablePalettedImage {
 	data := [][]byte{zero, one, two, three, four, five, six, seven, eight, nine}
 	digits := []mutablePalettedImage{}
 	for _, undecodedDigit := range data {
-		digits = append(digits, decode(undecodedDigit))
+		digit, err := decode(undecodedDigit)
+		if err != nil {
+			panic(err)
+		}
+		digits = append(digits, digit)
 	}
 	return digits
 }
 
 var digits = preloadReferenceDigits()
 
-func deleteNoise(captcha *mutablePalettedImage) *mutablePalettedImage {
-	bounds := (*captcha).Bounds()
+//compareDigits counts pixels which differ between the digit template and the digit of the captcha,
+//when the template's top left corner is at origin. Ink of the digit outside of the template differs too
+func compareDigits(digitLeft *mutablePalettedImage, digitRight *mutablePalettedImage, digit *segment, origin image.Point) int {
+	bounds := (*digitLeft).Bounds()
+	numberOfDifferences := 0
+	inkInside := 0
 
 	for x := 0; x < bounds.Max.X; x++ {
 		for y := 0; y < bounds.Max.Y; y++ {
-			pixel := (*captcha).ColorIndexAt(x, y)
-			if pixel != 2 {
-				(*captcha).Set(x, y, color.RGBA{255, 255, 255, 255})
+			pixelLeft := (*digitLeft).ColorIndexAt(x, y) == ink
+			pixelRight := digit.isInk(digitRight, origin.X+x, origin.Y+y)
+			if pixelRight {
+				inkInside++
+			}
+			if pixelLeft != pixelRight {
+				numberOfDifferences++
 			}
 		}
 	}
-	return captcha
+	return numberOfDifferences + digit.ink - inkInside
 }
 
-func compareDigits(digitLeft *mutablePalettedImage, digitRight *mutablePalettedImage, originX int) int {
-	bounds := (*digitLeft).Bounds()
-	numberOfDifferences := 0
-
-	for x := 0; x < bounds.Max.X; x++ {
-		for y := 0; y < bounds.Max.Y; y++ {
-			pixelLeft := (*digitLeft).ColorIndexAt(x, y)
-			pixelRight := (*digitRight).ColorIndexAt(originX+x, 2+y)
-			if pixelLeft != pixelRight {
-				numberOfDifferences = +1
+//matchDigit compares the template with the digit of the captcha aligning their ink and shifting the template
+//a few pixels in every direction. The best match wins, so slightly jittered digits match as well
+func matchDigit(template *mutablePalettedImage, captcha *mutablePalettedImage, digit *segment) int {
+	templateInk, _ := inkBounds(*template, (*template).Bounds())
+	aligned := digit.bounds.Min.Sub(templateInk.Min)
+	best := math.MaxInt32
+	for dx := -maxShift; dx <= maxShift; dx++ {
+		for dy := -maxShift; dy <= maxShift; dy++ {
+			if result := compareDigits(template, captcha, digit, aligned.Add(image.Pt(dx, dy))); result < best {
+				best = result
 			}
 		}
 	}
-	return numberOfDifferences
+	return best
 }
 
-func convertToString(captcha *mutablePalettedImage, originX int) string {
-	minDiff := 1000
+//digitConfidence tells how much better the best matching digit is than the second best one.
+//It is 1 if the best digit matches exactly and 0 if two digits match equally well
+func digitConfidence(best int, secondBest int) float64 {
+	if secondBest == 0 {
+		return 0
+	}
+	return 1 - float64(best)/float64(secondBest)
+}
+
+func recognizeDigit(captcha *mutablePalettedImage, digit *segment) (int, float64) {
+	best, secondBest := math.MaxInt32, math.MaxInt32
 	index := 0
-	for i, digit := range digits {
-		result := compareDigits(&digit, captcha, originX)
-		if result < minDiff {
-			minDiff = result
+	for i, template := range digits {
+		result := matchDigit(&template, captcha, digit)
+		if result < best {
+			best, secondBest = result, best
 			index = i
+		} else if result < secondBest {
+			secondBest = result
 		}
 	}
-	return strconv.Itoa(index)
+	return index, digitConfidence(best, secondBest)
+}
+
+//Recognition is the result of captcha recognition
+type Recognition struct {
+	Text string
+	//Digits holds confidence of every digit between 0 and 1
+	Digits []float64
+	//Confidence is the confidence of the least certain digit. It is 0 if no digits were found
+	Confidence float64
 }
 
+//Recognize finds digits of the captcha, recognizes them and tells how confident it is in every one of them.
+//Returns error if the captcha is not an image
+func Recognize(captcha []byte) (*Recognition, error) {
+	decodedCaptcha, err := decode(captcha)
+	if err != nil {
+		return nil, err
+	}
+	recognition := &Recognition{}
+	stringDigits := []string{}
+	for i, digit := range segmentDigits(decodedCaptcha) {
+		recognized, confidence := recognizeDigit(&decodedCaptcha, digit)
+		stringDigits = append(stringDigits, strconv.Itoa(recognized))
+		recognition.Digits = append(recognition.Digits, confidence)
+		if i == 0 || confidence < recognition.Confidence {
+			recognition.Confidence = confidence
+		}
+	}
+	recognition.Text = strings.Join(stringDigits, "")
+	return recognition, nil
+}
+
+//RecognizeCaptcha returns the digits of the captcha. Returns empty string if the captcha is not an image
 func RecognizeCaptcha(captcha *[]byte) string {
-	decodedCaptcha := decode(*captcha)
-	cleanCaptcha := deleteNoise(&decodedCaptcha)
-	stringDigits := [6]string{}
-	for i := 0; i <= 5; i++ {
-		originX := 10 + i*12
-		stringDigits[i] = convertToString(cleanCaptcha, originX)
+	recognition, err := Recognize(*captcha)
+	if err != nil {
+		log.Errorf("Unable to recognize captcha: %s", err)
+		return ""
 	}
-	return strings.Join(stringDigits[:], "")
+	return recognition.Text
 }
@@ -0,0 +1,86 @@
+package captcha
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+
+	. "gopkg.in/check.v1"
+)
+
+type DecodeSuite struct{}
+
+var _ = Suite(&DecodeSuite{})
+
+func (s *DecodeSuite) TestJPEG(c *C) {
+	encoded := &bytes.Buffer{}
+	c.Assert(jpeg.Encode(encoded, synthesizeImage("123456"), &jpeg.Options{Quality: 75}), IsNil)
+	c.Assert(recognize(c, encoded.Bytes()).Text, Equals, "123456")
+}
+
+func (s *DecodeSuite) TestGIF(c *C) {
+	encoded := &bytes.Buffer{}
+	c.Assert(gif.Encode(encoded, synthesizeImage("789012"), nil), IsNil)
+	c.Assert(recognize(c, encoded.Bytes()).Text, Equals, "789012")
+}
+
+func (s *DecodeSuite) TestTrueColourWithTransparentBackgroundAndNoise(c *C) {
+	digitsImage := synthesizeImage("345678")
+	bounds := digitsImage.Bounds()
+	captcha := image.NewNRGBA(bounds)
+	for x := 0; x < bounds.Max.X; x++ {
+		for y := 0; y < bounds.Max.Y; y++ {
+			switch {
+			case digitsImage.ColorIndexAt(x, y) == ink:
+				captcha.Set(x, y, color.NRGBA{R: 20, G: 30, B: 120, A: 255})
+			case (x+y)%7 == 0:
+				captcha.Set(x, y, color.NRGBA{R: 200, G: 220, B: 180, A: 255})
+			}
+		}
+	}
+	c.Assert(recognize(c, encode(captcha)).Text, Equals, "345678")
+}
+
+func (s *DecodeSuite) TestPalettedWithDarkNoise(c *C) {
+	digitsImage := synthesizeImage("901234")
+	bounds := digitsImage.Bounds()
+	palette := color.Palette{color.White, color.RGBA{40, 40, 40, 255}, color.Black, color.RGBA{180, 200, 230, 255}}
+	captcha := image.NewPaletted(bounds, palette)
+	for x := 0; x < bounds.Max.X; x++ {
+		for y := 0; y < bounds.Max.Y; y++ {
+			switch {
+			case digitsImage.ColorIndexAt(x, y) == ink:
+				captcha.SetColorIndex(x, y, portalInk)
+			case y == 9 || (x+2*y)%5 == 0:
+				captcha.SetColorIndex(x, y, 1)
+			case (x+y)%3 == 0:
+				captcha.SetColorIndex(x, y, 3)
+			}
+		}
+	}
+	c.Assert(recognize(c, encode(captcha)).Text, Equals, "901234")
+}
+
+func (s *DecodeSuite) TestNotImage(c *C) {
+	page := []byte("<html><body>Service Unavailable</body></html>")
+	_, err := Recognize(page)
+	c.Assert(err, ErrorMatches, "captcha is not an image: .*")
+	_, _, err = TemplateSolver{}.Solve(context.Background(), page)
+	c.Assert(err, NotNil)
+	c.Assert(RecognizeCaptcha(&page), Equals, "")
+	c.Assert(NewTrainer().Add(page, "123456"), NotNil)
+}
+
+func (s *DecodeSuite) TestOtsuThreshold(c *C) {
+	histogram := [256]int{}
+	histogram[10] = 30
+	histogram[20] = 10
+	histogram[200] = 50
+	histogram[250] = 100
+	threshold := otsuThreshold(histogram)
+	c.Assert(threshold > 20 && threshold <= 200, Equals, true)
+	c.Assert(otsuThreshold([256]int{255: 10}), Equals, uint8(0))
+}
@@ -0,0 +1,142 @@
+package captcha
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+//corpus holds labelled captchas of the portal, see AnswerOf. Run "go test ./captcha -v -check.f Corpus" to see the reports
+const corpus = "testdata/corpus"
+
+//synthetic holds captchas drawn with the embedded templates. They are recognized by matching the very same templates,
+//so their accuracy only shows that segmentation and binarization cope with jitter and noise, not how real captchas are recognized
+const synthetic = "testdata/synthetic"
+
+var generateCorpus = flag.Bool("corpus.generate", false, "regenerate the synthetic captchas")
+
+type CorpusSuite struct{}
+
+var _ = Suite(&CorpusSuite{})
+
+func (s *CorpusSuite) SetUpSuite(c *C) {
+	if *generateCorpus {
+		c.Assert(os.RemoveAll(synthetic), IsNil)
+		c.Assert(generate(synthetic, 60), IsNil)
+	}
+}
+
+func evaluate(c *C, title string, dir string) *Report {
+	report, err := Evaluate(dir)
+	c.Assert(err, IsNil)
+	if testing.Verbose() && report.Captchas > 0 {
+		fmt.Printf("%s captchas of [%s]\n%s", title, dir, report)
+	}
+	return report
+}
+
+func (s *CorpusSuite) TestAccuracy(c *C) {
+	if report := evaluate(c, "Portal", corpus); report.Captchas == 0 {
+		c.Skip("no labelled captchas of the portal in " + corpus)
+	}
+}
+
+func (s *CorpusSuite) TestSyntheticAccuracy(c *C) {
+	report := evaluate(c, "Synthetic", synthetic)
+	c.Assert(report.Captchas >= 60, Equals, true)
+	//floors below what the recognizer reaches now, so that changes making segmentation or binarization worse fail
+	c.Assert(report.Accuracy() >= 0.9, Equals, true, Commentf("%s", report))
+	for digit := 0; digit < 10; digit++ {
+		c.Assert(report.DigitAccuracy(digit) >= 0.9, Equals, true, Commentf("%s", report))
+	}
+}
+
+func (s *CorpusSuite) TestReport(c *C) {
+	report := &Report{}
+	report.add("123", "123", 2)
+	report.add("123", "173", 4)
+	report.add("123", "12", 6)
+
+	c.Assert(report.Accuracy(), Equals, 1.0/3)
+	c.Assert(report.DigitAccuracy(1), Equals, 1.0)
+	c.Assert(report.DigitAccuracy(2), Equals, 2.0/3)
+	c.Assert(report.Confusion[2][7], Equals, 1)
+	c.Assert(report.Confusion[3][missing], Equals, 1)
+	c.Assert(report.AverageLatency(), Equals, time.Duration(4))
+	c.Assert(report.MaxLatency, Equals, time.Duration(6))
+}
+
+func benchmarkRecognize(b *testing.B, dir string) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.png"))
+	if err != nil || len(files) == 0 {
+		b.Skipf("no captchas in [%s]", dir)
+	}
+	captchas := [][]byte{}
+	for _, file := range files {
+		captcha, err := ioutil.ReadFile(file)
+		if err != nil {
+			b.Fatal(err)
+		}
+		captchas = append(captchas, captcha)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Recognize(captchas[i%len(captchas)])
+	}
+}
+
+func BenchmarkRecognize(b *testing.B) {
+	benchmarkRecognize(b, corpus)
+}
+
+func BenchmarkRecognizeSynthetic(b *testing.B) {
+	benchmarkRecognize(b, synthetic)
+}
+
+//generate writes captchas of random digits drawn with the templates, slightly jittered and spoiled with noise
+//of colours other than the ink
+func generate(dir string, count int) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	random := rand.New(rand.NewSource(22))
+	palette := color.Palette{color.White, color.RGBA{180, 200, 230, 255}, color.Black, color.RGBA{230, 190, 190, 255}}
+	for i := 0; i < count; i++ {
+		answer := ""
+		origins := []image.Point{}
+		x := 6 + random.Intn(8)
+		for d := 0; d < 6; d++ {
+			answer += fmt.Sprint(random.Intn(10))
+			origins = append(origins, image.Pt(x, 1+random.Intn(3)))
+			x += 12 + random.Intn(3)
+		}
+		digitsImage := synthesizeAt(answer, origins...)
+		captcha := image.NewPaletted(image.Rect(0, 0, 100, 20), palette)
+		for x := 0; x < 100; x++ {
+			for y := 0; y < 20; y++ {
+				switch {
+				case digitsImage.ColorIndexAt(x, y) == ink && random.Intn(100) >= 5:
+					captcha.SetColorIndex(x, y, 2)
+				case random.Intn(1000) < 3:
+					captcha.SetColorIndex(x, y, 2)
+				case random.Intn(100) < 15:
+					captcha.SetColorIndex(x, y, uint8(1+2*random.Intn(2)))
+				}
+			}
+		}
+		name := fmt.Sprintf("%s_%d.png", answer, i)
+		if err := ioutil.WriteFile(filepath.Join(dir, name), encode(captcha), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
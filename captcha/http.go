@@ -0,0 +1,58 @@
+package captcha
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+//HTTPSolver sends the captcha image to an external recognition service.
+//The service receives the image as the body of a POST request and answers with {"text": "123456", "confidence": 0.9}
+type HTTPSolver struct {
+	URL string
+	//Timeout limits a single recognition. Zero means no limit
+	Timeout time.Duration
+	Client  *http.Client
+}
+
+type httpAnswer struct {
+	Text       string  `json:"text"`
+	Confidence float64 `json:"confidence"`
+}
+
+//Solve asks the service to recognize the captcha
+func (h *HTTPSolver) Solve(ctx context.Context, image []byte) (string, float64, error) {
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+		defer cancel()
+	}
+	request, err := http.NewRequestWithContext(ctx, "POST", h.URL, bytes.NewReader(image))
+	if err != nil {
+		return "", 0, err
+	}
+	request.Header.Set("Content-Type", http.DetectContentType(image))
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return "", 0, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("captcha service answered [%s]", response.Status)
+	}
+	answer := &httpAnswer{}
+	if err := json.NewDecoder(response.Body).Decode(answer); err != nil {
+		return "", 0, err
+	}
+	if answer.Text == "" {
+		return "", 0, fmt.Errorf("captcha service gave no answer")
+	}
+	return answer.Text, answer.Confidence, nil
+}
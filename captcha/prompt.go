@@ -0,0 +1,176 @@
+package captcha
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+//LineReader reads lines typed by the user
+type LineReader interface {
+	ReadLine(ctx context.Context) (string, error)
+}
+
+type lineReader struct {
+	lines chan string
+}
+
+//NewLineReader reads lines from the given reader, e.g. os.Stdin, in background
+func NewLineReader(reader io.Reader) LineReader {
+	lr := &lineReader{lines: make(chan string)}
+	go func() {
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			lr.lines <- scanner.Text()
+		}
+		close(lr.lines)
+	}()
+	return lr
+}
+
+func (lr *lineReader) ReadLine(ctx context.Context) (string, error) {
+	select {
+	case line, ok := <-lr.lines:
+		if !ok {
+			return "", io.EOF
+		}
+		return line, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+//Ways to show the captcha in the terminal
+const (
+	//RenderColor draws the captcha with ANSI colours, two pixels per character
+	RenderColor = "color"
+	//RenderText draws dark pixels of the captcha as # characters
+	RenderText = "text"
+	//RenderFile saves the captcha to a temporary file and prints its path. It is removed once the answer is given
+	RenderFile = "file"
+)
+
+//PromptSolver shows the captcha in the terminal and asks the user to type it.
+//Only one captcha is shown at a time
+type PromptSolver struct {
+	out     io.Writer
+	in      LineReader
+	timeout time.Duration
+	render  string
+	lock    *sync.Mutex
+}
+
+//NewPromptSolver creates solver which shows captchas in out the given way and reads answers from in.
+//Zero timeout means waiting for the answer until the context is done
+func NewPromptSolver(out io.Writer, in LineReader, timeout time.Duration, render string) (*PromptSolver, error) {
+	switch render {
+	case RenderColor, RenderText, RenderFile:
+	default:
+		return nil, fmt.Errorf("unsupported captcha rendering [%s]", render)
+	}
+	return &PromptSolver{out: out, in: in, timeout: timeout, render: render, lock: &sync.Mutex{}}, nil
+}
+
+//Solve shows the captcha and waits for the answer
+func (p *PromptSolver) Solve(ctx context.Context, captchaImage []byte) (string, float64, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	img, _, err := image.Decode(bytes.NewReader(captchaImage))
+	if err != nil {
+		return "", 0, err
+	}
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+	switch p.render {
+	case RenderColor:
+		fmt.Fprint(p.out, renderANSI(img))
+	case RenderText:
+		fmt.Fprintln(p.out, renderASCII(img))
+	case RenderFile:
+		path, err := saveTemporary(captchaImage)
+		if err != nil {
+			return "", 0, err
+		}
+		defer os.Remove(path)
+		fmt.Fprintf(p.out, "Captcha is saved to %s\n", path)
+	}
+	fmt.Fprint(p.out, "Type the digits and press Enter: ")
+	answer, err := p.in.ReadLine(ctx)
+	fmt.Fprintln(p.out)
+	if err != nil {
+		return "", 0, err
+	}
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return "", 0, fmt.Errorf("no answer given")
+	}
+	return answer, 1, nil
+}
+
+//saveTemporary saves the captcha to a new temporary file and returns its path
+func saveTemporary(captchaImage []byte) (string, error) {
+	file, err := ioutil.TempFile("", "captcha-*.png")
+	if err != nil {
+		return "", err
+	}
+	_, err = file.Write(captchaImage)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+//renderANSI draws the image with upper half block characters. The foreground colour of a character is the pixel above,
+//the background colour is the pixel below, so every pixel is about square and a 12x16 digit takes 12x8 characters
+func renderANSI(img image.Image) string {
+	bounds := img.Bounds()
+	rendered := &strings.Builder{}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += 2 {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			fmt.Fprintf(rendered, "\x1b[38;2;%d;%d;%dm", r>>8, g>>8, b>>8)
+			if y+1 < bounds.Max.Y {
+				r, g, b, _ = img.At(x, y+1).RGBA()
+				fmt.Fprintf(rendered, "\x1b[48;2;%d;%d;%dm", r>>8, g>>8, b>>8)
+			} else {
+				rendered.WriteString("\x1b[49m")
+			}
+			rendered.WriteString("\u2580")
+		}
+		rendered.WriteString("\x1b[0m\n")
+	}
+	return rendered.String()
+}
+
+//renderASCII draws dark pixels of the image as # characters
+func renderASCII(img image.Image) string {
+	bounds := img.Bounds()
+	rendered := &strings.Builder{}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y < 128 {
+				rendered.WriteByte('#')
+			} else {
+				rendered.WriteByte(' ')
+			}
+		}
+		rendered.WriteByte('\n')
+	}
+	return rendered.String()
+}
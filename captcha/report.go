@@ -0,0 +1,125 @@
+package captcha
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//missing is the column of the confusion matrix for digits which were not found at all
+const missing = 10
+
+//Report tells how well captchas of a labelled corpus are recognized
+type Report struct {
+	Captchas int
+	//Correct is the number of captchas recognized entirely
+	Correct int
+	//Confusion counts how every digit was recognized. Rows are the expected digits, columns are the recognized ones.
+	//The last column counts digits which were not found
+	Confusion  [10][11]int
+	Latency    time.Duration
+	MaxLatency time.Duration
+}
+
+//Evaluate recognizes every labelled captcha of the directory, see AnswerOf, and compares the text with the answer.
+//Captchas which are not images are not recognized at all
+func Evaluate(dir string) (*Report, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		answer := AnswerOf(path)
+		if answer == "" || strings.Trim(answer, "0123456789") != "" {
+			continue
+		}
+		captcha, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		started := time.Now()
+		text := ""
+		if recognition, err := Recognize(captcha); err == nil {
+			text = recognition.Text
+		}
+		report.add(answer, text, time.Since(started))
+	}
+	return report, nil
+}
+
+func (r *Report) add(answer string, text string, latency time.Duration) {
+	r.Captchas++
+	if answer == text {
+		r.Correct++
+	}
+	for i, char := range answer {
+		recognized := missing
+		if i < len(text) {
+			recognized = int(text[i] - '0')
+		}
+		r.Confusion[char-'0'][recognized]++
+	}
+	r.Latency += latency
+	if latency > r.MaxLatency {
+		r.MaxLatency = latency
+	}
+}
+
+//Accuracy returns the share of the captchas recognized entirely
+func (r *Report) Accuracy() float64 {
+	if r.Captchas == 0 {
+		return 0
+	}
+	return float64(r.Correct) / float64(r.Captchas)
+}
+
+//DigitAccuracy returns the share of the samples of the digit recognized correctly
+func (r *Report) DigitAccuracy(digit int) float64 {
+	total := 0
+	for _, count := range r.Confusion[digit] {
+		total += count
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(r.Confusion[digit][digit]) / float64(total)
+}
+
+//AverageLatency returns the average time of recognition of a captcha
+func (r *Report) AverageLatency() time.Duration {
+	if r.Captchas == 0 {
+		return 0
+	}
+	return r.Latency / time.Duration(r.Captchas)
+}
+
+func (r *Report) String() string {
+	report := &strings.Builder{}
+	fmt.Fprintf(report, "Captchas: %d, recognized entirely: %d (%.1f%%)\n", r.Captchas, r.Correct, 100*r.Accuracy())
+	fmt.Fprintf(report, "Latency: %s on average, %s at most\n", r.AverageLatency(), r.MaxLatency)
+	fmt.Fprintln(report, "Digit accuracy:")
+	for digit := 0; digit < 10; digit++ {
+		fmt.Fprintf(report, "  %d: %.1f%%\n", digit, 100*r.DigitAccuracy(digit))
+	}
+	fmt.Fprintln(report, "Confusion matrix (rows are expected digits, columns are recognized ones, ? is not found):")
+	fmt.Fprint(report, "    ")
+	for digit := 0; digit < 10; digit++ {
+		fmt.Fprintf(report, "%5d", digit)
+	}
+	fmt.Fprintf(report, "%5s\n", "?")
+	for digit, row := range r.Confusion {
+		fmt.Fprintf(report, "%4d", digit)
+		for _, count := range row {
+			fmt.Fprintf(report, "%5d", count)
+		}
+		fmt.Fprintln(report)
+	}
+	return report.String()
+}
@@ -0,0 +1,117 @@
+package captcha
+
+import (
+	"image"
+	"math"
+)
+
+//maxShift is how far in pixels a digit may be off its template in any direction
+const maxShift = 2
+
+//minInk is the least number of ink pixels of a digit. Smaller blobs are noise
+const minInk = 6
+
+//segment is a digit found in the captcha
+type segment struct {
+	bounds image.Rectangle
+	//ink is the number of ink pixels of the digit
+	ink int
+}
+
+//isInk tells whether the pixel belongs to the digit. Ink of the neighbour digits doesn't
+func (s *segment) isInk(captcha *mutablePalettedImage, x int, y int) bool {
+	return image.Pt(x, y).In(s.bounds) && (*captcha).ColorIndexAt(x, y) == ink
+}
+
+//inkBounds returns the smallest rectangle within the area which holds all its ink and the number of ink pixels
+func inkBounds(img image.PalettedImage, area image.Rectangle) (image.Rectangle, int) {
+	bounds := image.Rectangle{}
+	count := 0
+	for x := area.Min.X; x < area.Max.X; x++ {
+		for y := area.Min.Y; y < area.Max.Y; y++ {
+			if img.ColorIndexAt(x, y) == ink {
+				bounds = bounds.Union(image.Rect(x, y, x+1, y+1))
+				count++
+			}
+		}
+	}
+	return bounds, count
+}
+
+//newSegment returns the digit found in the area of the captcha
+func newSegment(captcha mutablePalettedImage, area image.Rectangle) *segment {
+	bounds, count := inkBounds(captcha, area)
+	return &segment{bounds: bounds, ink: count}
+}
+
+//segmentDigits finds digits of the captcha by projecting its ink onto columns.
+//Every run of columns with ink is a digit. Runs too wide for a single digit hold several touching digits and are split
+func segmentDigits(captcha mutablePalettedImage) []*segment {
+	bounds := captcha.Bounds()
+	columns := make([]int, bounds.Dx())
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			if captcha.ColorIndexAt(x, y) == ink {
+				columns[x-bounds.Min.X]++
+			}
+		}
+	}
+	segments := []*segment{}
+	for start := 0; start < len(columns); {
+		if columns[start] == 0 {
+			start++
+			continue
+		}
+		end := start
+		for end < len(columns) && columns[end] > 0 {
+			end++
+		}
+		run := image.Rect(bounds.Min.X+start, bounds.Min.Y, bounds.Min.X+end, bounds.Max.Y)
+		for _, digit := range splitRun(captcha, run) {
+			if digit.ink >= minInk {
+				segments = append(segments, digit)
+			}
+		}
+		start = end
+	}
+	return segments
+}
+
+//splitRun cuts the run of columns into as many digits as fit into its width.
+//Every cut is made near the place where it is expected, so that the digit left of it matches some template best
+func splitRun(captcha mutablePalettedImage, run image.Rectangle) []*segment {
+	count := (run.Dx() + digitWidth/2) / digitWidth
+	segments := []*segment{}
+	from := run.Min.X
+	for i := 1; i < count; i++ {
+		expected := run.Min.X + i*run.Dx()/count
+		var best *segment
+		bestCut, bestResult := expected, math.MaxInt32
+		for cut := expected - maxShift; cut <= expected+maxShift; cut++ {
+			if cut <= from || cut >= run.Max.X {
+				continue
+			}
+			digit := newSegment(captcha, image.Rect(from, run.Min.Y, cut, run.Max.Y))
+			if result := bestMatch(&captcha, digit); result < bestResult {
+				best, bestCut, bestResult = digit, cut, result
+			}
+		}
+		if best == nil {
+			continue
+		}
+		segments = append(segments, best)
+		from = bestCut
+	}
+	return append(segments, newSegment(captcha, image.Rect(from, run.Min.Y, run.Max.X, run.Max.Y)))
+}
+
+//bestMatch returns the number of differences between the digit and the template which matches it best
+func bestMatch(captcha *mutablePalettedImage, digit *segment) int {
+	best := math.MaxInt32
+	for _, template := range digits {
+		if result := matchDigit(&template, captcha, digit); result < best {
+			best = result
+		}
+	}
+	return best
+}
@@ -0,0 +1,43 @@
+package captcha
+
+import (
+	"image"
+
+	. "gopkg.in/check.v1"
+)
+
+type SegmentSuite struct{}
+
+var _ = Suite(&SegmentSuite{})
+
+func (s *SegmentSuite) TestAnyLength(c *C) {
+	c.Assert(recognize(c, synthesize("7")).Text, Equals, "7")
+	c.Assert(recognize(c, synthesize("0123456789")).Text, Equals, "0123456789")
+}
+
+func (s *SegmentSuite) TestIrregularSpacing(c *C) {
+	captcha := synthesizeAt("4096", image.Pt(3, 1), image.Pt(25, 4), image.Pt(37, 0), image.Pt(60, 3))
+	recognition := recognize(c, encode(captcha))
+	c.Assert(recognition.Text, Equals, "4096")
+	c.Assert(recognition.Confidence, Equals, 1.0)
+}
+
+func (s *SegmentSuite) TestTouchingDigitsWithJitter(c *C) {
+	captcha := synthesizeAt("58383", image.Pt(2, 2), image.Pt(13, 3), image.Pt(24, 1), image.Pt(35, 3), image.Pt(46, 2))
+	c.Assert(recognize(c, encode(captcha)).Text, Equals, "58383")
+}
+
+func (s *SegmentSuite) TestNoiseIsNotDigit(c *C) {
+	captcha := synthesizeImage("1234")
+	for x := 70; x < 73; x++ {
+		captcha.SetColorIndex(x, 10, ink)
+	}
+	c.Assert(recognize(c, encode(captcha)).Text, Equals, "1234")
+}
+
+func (s *SegmentSuite) TestBlankCaptcha(c *C) {
+	blank := image.NewPaletted(image.Rect(0, 0, 92, 20), newTemplate().Palette)
+	recognition := recognize(c, encode(blank))
+	c.Assert(recognition.Text, Equals, "")
+	c.Assert(recognition.Confidence, Equals, 0.0)
+}
@@ -0,0 +1,62 @@
+package captcha
+
+import (
+	"context"
+	"errors"
+)
+
+//ErrNotConfident is returned when the solvers are unsure of their answer. A fresh captcha should be solved instead
+var ErrNotConfident = errors.New("captcha solvers are not confident enough")
+
+//Solver recognizes the text of the captcha image. Confidence is between 0 and 1
+type Solver interface {
+	Solve(ctx context.Context, image []byte) (text string, confidence float64, err error)
+}
+
+//TemplateSolver recognizes the captcha by comparing its digits with the embedded templates
+type TemplateSolver struct{}
+
+//Solve recognizes the captcha. Confidence is the one of the least certain digit
+func (TemplateSolver) Solve(ctx context.Context, image []byte) (string, float64, error) {
+	recognition, err := Recognize(image)
+	if err != nil {
+		return "", 0, err
+	}
+	return recognition.Text, recognition.Confidence, nil
+}
+
+//ChainSolver tries the solvers in order until one of them is at least Threshold confident.
+//If none is, the most confident answer is returned with ErrNotConfident
+type ChainSolver struct {
+	Solvers   []Solver
+	Threshold float64
+}
+
+//Solve asks the solvers in order
+func (c *ChainSolver) Solve(ctx context.Context, image []byte) (string, float64, error) {
+	bestText, bestConfidence := "", -1.0
+	var lastErr error
+	for _, solver := range c.Solvers {
+		if ctx.Err() != nil {
+			return "", 0, ctx.Err()
+		}
+		text, confidence, err := solver.Solve(ctx, image)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if confidence >= c.Threshold {
+			return text, confidence, nil
+		}
+		if confidence > bestConfidence {
+			bestText, bestConfidence = text, confidence
+		}
+	}
+	if bestConfidence < 0 {
+		if lastErr == nil {
+			lastErr = ErrNotConfident
+		}
+		return "", 0, lastErr
+	}
+	return bestText, bestConfidence, ErrNotConfident
+}
@@ -0,0 +1,221 @@
+package captcha
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type SolverSuite struct{}
+
+var _ = Suite(&SolverSuite{})
+
+//synthesizeImage draws the answer with the template digits the way the portal lays them out
+func synthesizeImage(answer string) *image.Paletted {
+	origins := []image.Point{}
+	for i := range answer {
+		origins = append(origins, image.Pt(10+i*12, 2))
+	}
+	return synthesizeAt(answer, origins...)
+}
+
+//synthesizeAt draws digits of the answer with their top left corners at the origins
+func synthesizeAt(answer string, origins ...image.Point) *image.Paletted {
+	width := 0
+	for _, origin := range origins {
+		if origin.X+20 > width {
+			width = origin.X + 20
+		}
+	}
+	captcha := image.NewPaletted(image.Rect(0, 0, width, 20), digits[0].(*image.Paletted).Palette)
+	for i, char := range answer {
+		digit := digits[char-'0']
+		bounds := digit.Bounds()
+		for x := 0; x < bounds.Max.X; x++ {
+			for y := 0; y < bounds.Max.Y; y++ {
+				if digit.ColorIndexAt(x, y) == ink {
+					captcha.SetColorIndex(origins[i].X+x, origins[i].Y+y, ink)
+				}
+			}
+		}
+	}
+	return captcha
+}
+
+func recognize(c *C, captcha []byte) *Recognition {
+	recognition, err := Recognize(captcha)
+	c.Assert(err, IsNil)
+	return recognition
+}
+
+func encode(captcha image.Image) []byte {
+	encoded := &bytes.Buffer{}
+	png.Encode(encoded, captcha)
+	return encoded.Bytes()
+}
+
+func synthesize(answer string) []byte {
+	return encode(synthesizeImage(answer))
+}
+
+type stubSolver struct {
+	text       string
+	confidence float64
+	err        error
+	calls      int
+}
+
+func (s *stubSolver) Solve(ctx context.Context, image []byte) (string, float64, error) {
+	s.calls++
+	return s.text, s.confidence, s.err
+}
+
+func (s *SolverSuite) TestTemplateSolver(c *C) {
+	text, confidence, err := TemplateSolver{}.Solve(context.Background(), synthesize("093871"))
+	c.Assert(err, IsNil)
+	c.Assert(text, Equals, "093871")
+	c.Assert(confidence, Equals, 1.0)
+}
+
+func (s *SolverSuite) TestConfidence(c *C) {
+	recognition := recognize(c, synthesize("123456"))
+	c.Assert(recognition.Text, Equals, "123456")
+	c.Assert(recognition.Digits, DeepEquals, []float64{1, 1, 1, 1, 1, 1})
+
+	damaged := synthesizeImage("888888")
+	for x := 10; x < 16; x++ {
+		for y := 2; y < 18; y++ {
+			damaged.SetColorIndex(x, y, 0)
+		}
+	}
+	recognition = recognize(c, encode(damaged))
+	c.Assert(recognition.Text[1:], Equals, "88888")
+	c.Assert(recognition.Digits[0] < 1, Equals, true)
+	c.Assert(recognition.Confidence, Equals, recognition.Digits[0])
+}
+
+func (s *SolverSuite) TestChainStopsAtConfidentSolver(c *C) {
+	unsure := &stubSolver{text: "111111", confidence: 0.3}
+	broken := &stubSolver{err: errors.New("broken")}
+	sure := &stubSolver{text: "123456", confidence: 0.9}
+	never := &stubSolver{text: "000000", confidence: 1}
+	chain := &ChainSolver{Solvers: []Solver{unsure, broken, sure, never}, Threshold: 0.8}
+
+	text, confidence, err := chain.Solve(context.Background(), nil)
+	c.Assert(err, IsNil)
+	c.Assert(text, Equals, "123456")
+	c.Assert(confidence, Equals, 0.9)
+	c.Assert(never.calls, Equals, 0)
+}
+
+func (s *SolverSuite) TestChainIsNotConfident(c *C) {
+	chain := &ChainSolver{Solvers: []Solver{&stubSolver{text: "111111", confidence: 0.3}, &stubSolver{text: "222222", confidence: 0.5}}, Threshold: 0.8}
+	text, confidence, err := chain.Solve(context.Background(), nil)
+	c.Assert(err, Equals, ErrNotConfident)
+	c.Assert(text, Equals, "222222")
+	c.Assert(confidence, Equals, 0.5)
+}
+
+func (s *SolverSuite) TestHTTPSolver(c *C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		image, _ := ioutil.ReadAll(r.Body)
+		if len(image) == 0 {
+			http.Error(w, "no image", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"text": "654321", "confidence": 0.75}`))
+	}))
+	defer server.Close()
+	solver := &HTTPSolver{URL: server.URL, Timeout: time.Second}
+
+	text, confidence, err := solver.Solve(context.Background(), synthesize("654321"))
+	c.Assert(err, IsNil)
+	c.Assert(text, Equals, "654321")
+	c.Assert(confidence, Equals, 0.75)
+	_, _, err = solver.Solve(context.Background(), nil)
+	c.Assert(err, NotNil)
+}
+
+func (s *SolverSuite) TestPromptSolver(c *C) {
+	out := &bytes.Buffer{}
+	solver, err := NewPromptSolver(out, NewLineReader(strings.NewReader(" 246810 \n")), time.Second, RenderText)
+	c.Assert(err, IsNil)
+
+	text, confidence, err := solver.Solve(context.Background(), synthesize("246810"))
+	c.Assert(err, IsNil)
+	c.Assert(text, Equals, "246810")
+	c.Assert(confidence, Equals, 1.0)
+	c.Assert(strings.Contains(out.String(), "#"), Equals, true)
+}
+
+func (s *SolverSuite) TestPromptSolverColor(c *C) {
+	out := &bytes.Buffer{}
+	solver, _ := NewPromptSolver(out, NewLineReader(strings.NewReader("1\n")), time.Second, RenderColor)
+	_, _, err := solver.Solve(context.Background(), synthesize("1"))
+	c.Assert(err, IsNil)
+
+	lines := strings.Split(out.String(), "\n")
+	c.Assert(strings.Count(lines[0], "\u2580"), Equals, 12*1+18)
+	c.Assert(strings.HasPrefix(lines[0], "\x1b[38;2;255;255;255m\x1b[48;2;255;255;255m\u2580"), Equals, true)
+	c.Assert(strings.Contains(out.String(), "\x1b[38;2;0;0;0m"), Equals, true)
+	c.Assert(strings.HasSuffix(lines[0], "\x1b[0m"), Equals, true)
+	c.Assert(strings.HasPrefix(lines[10], "Type the digits"), Equals, true)
+}
+
+//savedCaptchaReader answers with the text of the captcha saved to the file whose path was printed
+type savedCaptchaReader struct {
+	out *bytes.Buffer
+}
+
+func (r *savedCaptchaReader) ReadLine(ctx context.Context) (string, error) {
+	captcha, err := ioutil.ReadFile(savedPath(r.out))
+	if err != nil {
+		return "", err
+	}
+	recognition, err := Recognize(captcha)
+	if err != nil {
+		return "", err
+	}
+	return recognition.Text, nil
+}
+
+func savedPath(out *bytes.Buffer) string {
+	return strings.TrimPrefix(strings.Split(out.String(), "\n")[0], "Captcha is saved to ")
+}
+
+func (s *SolverSuite) TestPromptSolverFile(c *C) {
+	out := &bytes.Buffer{}
+	solver, _ := NewPromptSolver(out, &savedCaptchaReader{out: out}, time.Second, RenderFile)
+
+	text, _, err := solver.Solve(context.Background(), synthesize("135790"))
+	c.Assert(err, IsNil)
+	c.Assert(text, Equals, "135790")
+	_, err = os.Stat(savedPath(out))
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *SolverSuite) TestUnsupportedRendering(c *C) {
+	_, err := NewPromptSolver(ioutil.Discard, NewLineReader(strings.NewReader("")), time.Second, "sixel")
+	c.Assert(err, ErrorMatches, "unsupported captcha rendering \\[sixel\\]")
+}
+
+func (s *SolverSuite) TestPromptSolverTimeout(c *C) {
+	reader, _ := io.Pipe()
+	solver, _ := NewPromptSolver(ioutil.Discard, NewLineReader(reader), 10*time.Millisecond, RenderText)
+	_, _, err := solver.Solve(context.Background(), synthesize("1"))
+	c.Assert(err, Equals, context.DeadlineExceeded)
+}
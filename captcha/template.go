@@ -0,0 +1,155 @@
+package captcha
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+const digitWidth = 12
+const digitHeight = 16
+
+//LoadTemplates replaces the embedded digit templates with the ones from the template file.
+//The file is an image strip of ten dark digits from 0 to 9 on light background, each 12x16 pixels, as written by Trainer.Save
+func LoadTemplates(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	strip, err := decode(data)
+	if err != nil {
+		return fmt.Errorf("unable to decode templates [%s]: %s", path, err)
+	}
+	if strip.Bounds().Dx() != 10*digitWidth || strip.Bounds().Dy() != digitHeight {
+		return fmt.Errorf("templates [%s] must be an image of %dx%d pixels", path, 10*digitWidth, digitHeight)
+	}
+	templates := []mutablePalettedImage{}
+	for i := 0; i < 10; i++ {
+		template := newTemplate()
+		for x := 0; x < digitWidth; x++ {
+			for y := 0; y < digitHeight; y++ {
+				if strip.ColorIndexAt(i*digitWidth+x, y) == ink {
+					template.SetColorIndex(x, y, ink)
+				}
+			}
+		}
+		templates = append(templates, template)
+	}
+	digits = templates
+	return nil
+}
+
+func newTemplate() *image.Paletted {
+	return image.NewPaletted(image.Rect(0, 0, digitWidth, digitHeight), binaryPalette)
+}
+
+//Trainer builds digit templates from labelled captchas.
+//A pixel of a template is ink if it is ink in most of the samples of the digit
+type Trainer struct {
+	ink     [10][]int
+	samples [10]int
+}
+
+//NewTrainer creates trainer without samples
+func NewTrainer() *Trainer {
+	t := &Trainer{}
+	for i := range t.ink {
+		t.ink[i] = make([]int, digitWidth*digitHeight)
+	}
+	return t
+}
+
+//Add finds digits of the captcha and counts them as samples of the digits of the answer.
+//Samples are aligned by the top left corner of their ink
+func (t *Trainer) Add(captcha []byte, answer string) error {
+	if answer == "" || strings.Trim(answer, "0123456789") != "" {
+		return fmt.Errorf("answer [%s] is not digits", answer)
+	}
+	decodedCaptcha, err := decode(captcha)
+	if err != nil {
+		return err
+	}
+	segments := segmentDigits(decodedCaptcha)
+	if len(segments) != len(answer) {
+		return fmt.Errorf("found %d digits instead of %d", len(segments), len(answer))
+	}
+	for i, char := range answer {
+		digit := char - '0'
+		origin := segments[i].bounds.Min
+		for x := 0; x < digitWidth; x++ {
+			for y := 0; y < digitHeight; y++ {
+				if segments[i].isInk(&decodedCaptcha, origin.X+x, origin.Y+y) {
+					t.ink[digit][y*digitWidth+x]++
+				}
+			}
+		}
+		t.samples[digit]++
+	}
+	return nil
+}
+
+//Samples returns the number of samples of every digit
+func (t *Trainer) Samples() [10]int {
+	return t.samples
+}
+
+//Save writes the template file. Digits without samples keep the templates currently in use
+func (t *Trainer) Save(path string) error {
+	strip := image.NewPaletted(image.Rect(0, 0, 10*digitWidth, digitHeight), binaryPalette)
+	for i := 0; i < 10; i++ {
+		for x := 0; x < digitWidth; x++ {
+			for y := 0; y < digitHeight; y++ {
+				isInk := digits[i].ColorIndexAt(x, y) == ink
+				if t.samples[i] > 0 {
+					isInk = 2*t.ink[i][y*digitWidth+x] > t.samples[i]
+				}
+				if isInk {
+					strip.SetColorIndex(i*digitWidth+x, y, ink)
+				}
+			}
+		}
+	}
+	encoded := &bytes.Buffer{}
+	if err := png.Encode(encoded, strip); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, encoded.Bytes(), 0644)
+}
+
+//AnswerOf returns the answer of the labelled captcha file. The file name up to the first dot or underscore is the answer,
+//so 123456.png and 123456_2.png are both captchas of 123456
+func AnswerOf(path string) string {
+	name := filepath.Base(path)
+	if end := strings.IndexAny(name, "._"); end >= 0 {
+		name = name[:end]
+	}
+	return name
+}
+
+//TrainDirectory adds every labelled captcha of the directory to the trainer.
+//Returns the reasons why files were skipped
+func (t *Trainer) TrainDirectory(dir string) ([]error, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	skipped := []error{}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		captcha, err := ioutil.ReadFile(path)
+		if err != nil {
+			return skipped, err
+		}
+		if err := t.Add(captcha, AnswerOf(path)); err != nil {
+			skipped = append(skipped, fmt.Errorf("%s: %s", file.Name(), err))
+		}
+	}
+	return skipped, nil
+}
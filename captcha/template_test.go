@@ -0,0 +1,74 @@
+package captcha
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+type TemplateSuite struct {
+	embedded []mutablePalettedImage
+	dir      string
+}
+
+var _ = Suite(&TemplateSuite{})
+
+func (s *TemplateSuite) SetUpTest(c *C) {
+	s.embedded = digits
+	s.dir = c.MkDir()
+}
+
+func (s *TemplateSuite) TearDownTest(c *C) {
+	digits = s.embedded
+}
+
+func (s *TemplateSuite) TestAnswerOf(c *C) {
+	c.Assert(AnswerOf("captchas/123456.png"), Equals, "123456")
+	c.Assert(AnswerOf("123456_2.png"), Equals, "123456")
+	c.Assert(AnswerOf("notes"), Equals, "notes")
+}
+
+func (s *TemplateSuite) TestTrainedTemplatesRecognizeCaptchas(c *C) {
+	c.Assert(ioutil.WriteFile(filepath.Join(s.dir, "012345.png"), synthesize("012345"), 0644), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(s.dir, "678901_1.png"), synthesize("678901"), 0644), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(s.dir, "notes.txt"), []byte("notes"), 0644), IsNil)
+	trainer := NewTrainer()
+
+	skipped, err := trainer.TrainDirectory(s.dir)
+	c.Assert(err, IsNil)
+	c.Assert(len(skipped), Equals, 1)
+	c.Assert(skipped[0], ErrorMatches, "notes.txt: answer \\[notes\\] is not digits")
+	c.Assert(trainer.Samples(), Equals, [10]int{2, 2, 1, 1, 1, 1, 1, 1, 1, 1})
+	path := filepath.Join(s.dir, "templates.png")
+	c.Assert(trainer.Save(path), IsNil)
+	c.Assert(LoadTemplates(path), IsNil)
+	c.Assert(recognize(c, synthesize("093871")).Text, Equals, "093871")
+}
+
+func (s *TemplateSuite) TestMostSamplesWin(c *C) {
+	trainer := NewTrainer()
+	c.Assert(trainer.Add(synthesize("777777"), "111111"), IsNil)
+	c.Assert(trainer.Add(synthesize("777777"), "111111"), IsNil)
+	c.Assert(trainer.Add(synthesize("111111"), "111111"), IsNil)
+	path := filepath.Join(s.dir, "templates.png")
+	c.Assert(trainer.Save(path), IsNil)
+	c.Assert(LoadTemplates(path), IsNil)
+
+	c.Assert(recognize(c, synthesize("7")).Digits[0], Equals, 0.0)
+	c.Assert(recognize(c, synthesize("222222")).Text, Equals, "222222")
+}
+
+func (s *TemplateSuite) TestWrongAnswer(c *C) {
+	c.Assert(NewTrainer().Add(synthesize("123456"), "12345"), ErrorMatches, "found 6 digits instead of 5")
+	c.Assert(NewTrainer().Add(synthesize("123456"), "12345a"), NotNil)
+}
+
+func (s *TemplateSuite) TestBrokenTemplateFile(c *C) {
+	path := filepath.Join(s.dir, "templates.png")
+	c.Assert(ioutil.WriteFile(path, synthesize("1"), 0644), IsNil)
+	c.Assert(LoadTemplates(path), NotNil)
+	c.Assert(os.IsNotExist(LoadTemplates(filepath.Join(s.dir, "missing.png"))), Equals, true)
+	c.Assert(recognize(c, synthesize("123456")).Text, Equals, "123456")
+}
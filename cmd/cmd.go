@@ -8,6 +8,9 @@ import (
 const ApplicationCommand = "application"
 const HeadofCommand = "headof"
 const HelpCommand = "help"
+const CaptchaCommand = "captcha"
+const TrainSubcommand = "train"
+const LabelSubcommand = "label"
 
 var help = `
 Usage:
@@ -34,6 +37,19 @@ Available Commands:
                                  LP2      Head of the LP II department
                                Examples:
                                  rezerwacje-duw-go head department LP1
+
+  captcha         Maintenance of the captcha recognition
+    Subcommands:
+      train <directory> [file] Build digit templates from labelled captcha images in the directory. The file name is the answer,
+                               e.g. 123456.png or 123456_2.png. Templates are written to the file, by default to the one
+                               configured in application.yml, and used instead of the embedded ones from the next run
+                               Examples:
+                                 rezerwacje-duw-go captcha train captchas
+      label [directory]        Show the archived captchas which were not accepted by the portal one by one and ask for
+                               the right answers. Labelled captchas are copied to the directory, "captchas" by default,
+                               ready for training. Press Enter without an answer to skip a captcha
+                               Examples:
+                                 rezerwacje-duw-go captcha label captchas
   `
 
 func PrintHelp() {
@@ -62,6 +78,17 @@ func ParseArgs() (string, []string, error) {
 				return command, args[2:], nil
 			}
 			return "", nil, fmt.Errorf("No department given")
+		case CaptchaCommand:
+			if len(args) > 1 && args[1] == TrainSubcommand {
+				if len(args) > 2 {
+					return command, args[1:], nil
+				}
+				return "", nil, fmt.Errorf("No directory of labelled captchas given")
+			}
+			if len(args) > 1 && args[1] == LabelSubcommand {
+				return command, args[1:], nil
+			}
+			return "", nil, fmt.Errorf("Unknown captcha subcommand")
 		case HelpCommand:
 			return command, nil, nil
 		default:
@@ -1,11 +1,14 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/ghodss/yaml"
 )
@@ -43,15 +46,193 @@ type Strings struct {
 	LpSubmissionDateHeader            string
 }
 
+//Duration is a time.Duration which is read from strings like "1m30s"
+type Duration struct {
+	time.Duration
+}
+
+//UnmarshalJSON parses duration string
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	d.Duration = duration
+	return nil
+}
+
+//Cookies represents settings of cookies persistence between restarts
+type Cookies struct {
+	File         string
+	SaveInterval Duration
+}
+
+//VCR represents settings of portal traffic recording and replaying
+type VCR struct {
+	Mode      string
+	Cassettes string
+}
+
+//Trace represents settings of request and response tracing to debug.log.
+//Names are redacted in addition to the built-in ones
+type Trace struct {
+	Mode       string
+	Headers    []string
+	FormFields []string
+	JSONKeys   []string
+}
+
+//BaseURL represents address of the portal. Allows to point the application to a mirror, a proxy or a local stand-in
+type BaseURL struct {
+	Scheme     string
+	Host       string
+	Port       int
+	PathPrefix string
+}
+
+//URL builds absolute url of the given portal path
+func (b BaseURL) URL(path string) string {
+	host := b.Host
+	if b.Port != 0 {
+		host = fmt.Sprintf("%s:%d", b.Host, b.Port)
+	}
+	prefix := strings.TrimRight(b.PathPrefix, "/")
+	if prefix != "" && !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	return fmt.Sprintf("%s://%s%s/%s", b.Scheme, host, prefix, strings.TrimLeft(path, "/"))
+}
+
+//RateLimit represents number of requests per second with allowed burst
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+//Proxies represents outbound proxies requests are rotated through
+type Proxies struct {
+	URLs                []string
+	MaxFailures         int
+	EjectFor            Duration
+	HealthCheckInterval Duration
+}
+
+//TLS represents settings of verification of the portal certificate
+type TLS struct {
+	CABundle string
+	Pins     []string
+	Insecure bool
+}
+
+//Header represents a single header of a browser profile
+type Header struct {
+	Name  string
+	Value string
+}
+
+//Profile represents headers of a browser the application presents itself as, in the order the browser sends them
+type Profile struct {
+	Name    string
+	Headers []Header
+}
+
+//Browser represents choice of the browser profile
+type Browser struct {
+	Profile string
+	Rotate  bool
+}
+
+//Warmup represents settings of opening connections to the portal ahead of the times new terms are released
+type Warmup struct {
+	Times       []string
+	Lead        Duration
+	Connections int
+	Interval    Duration
+}
+
+//Captcha represents settings of captcha recognition
+type Captcha struct {
+	Solvers   []string
+	Threshold float64
+	Attempts  int
+	URL       string
+	Timeout   Duration
+	Templates string
+	Render    string
+	Archive   string
+}
+
 //ApplicationConfig - just it
 type ApplicationConfig struct {
 	Strings           Strings
 	ParallelismFactor int
 	Https             bool
+	BaseURL           BaseURL
+	TLS               TLS
+	Language          string
+	Browser           Browser
+	Profiles          []*Profile
+	Timeouts          map[string]Duration
+	RateLimits        map[string]RateLimit
+	Proxies           Proxies
+	Users             []string
+	Warmup            Warmup
+	Captcha           Captcha
+	Cookies           Cookies
+	VCR               VCR
+	Trace             Trace
 	Cities            []*Entity
 	Departments       []*Entity
 }
 
+//Timeout returns deadline of the requests of the given kind.
+//Falls back to the "default" deadline if there is no specific one
+func (ac *ApplicationConfig) Timeout(kind string) time.Duration {
+	if timeout, ok := ac.Timeouts[kind]; ok {
+		return timeout.Duration
+	}
+	return ac.Timeouts["default"].Duration
+}
+
+//Portal returns address of the portal. Falls back to rezerwacje.duw.pl
+//if the host is not configured and to https flag if the scheme is not configured
+func (ac *ApplicationConfig) Portal() BaseURL {
+	baseURL := ac.BaseURL
+	if baseURL.Host == "" {
+		baseURL.Host = "rezerwacje.duw.pl"
+		baseURL.PathPrefix = "/reservations"
+	}
+	if baseURL.Scheme == "" {
+		baseURL.Scheme = "http"
+		if ac.Https {
+			baseURL.Scheme = "https"
+		}
+	}
+	return baseURL
+}
+
+//FindProfile returns browser profile with the given name
+func (ac *ApplicationConfig) FindProfile(name string) (*Profile, bool) {
+	for _, profile := range ac.Profiles {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+	return nil, false
+}
+
+//UserFiles returns files with details of the accounts to make reservations for. Falls back to user.yml
+func (ac *ApplicationConfig) UserFiles() []string {
+	if len(ac.Users) == 0 {
+		return []string{"user.yml"}
+	}
+	return ac.Users
+}
+
 //UserConfig - just it
 type UserConfig struct {
 	Login                  string
@@ -104,9 +285,9 @@ func initializeConfig(name string, configuration interface{}) {
 	}
 }
 
-func initializeUserConfig() *UserConfig {
+func initializeUserConfig(name string) *UserConfig {
 	configuration := &UserConfig{}
-	initializeConfig("user.yml", configuration)
+	initializeConfig(name, configuration)
 	return configuration
 }
 
@@ -118,7 +299,12 @@ func initializeApplicationConfig() *ApplicationConfig {
 
 //UserConf returns config with user specific details
 func UserConf() *UserConfig {
-	return initializeUserConfig()
+	return initializeUserConfig("user.yml")
+}
+
+//UserConfFrom returns config with details of the user described in the given file
+func UserConfFrom(name string) *UserConfig {
+	return initializeUserConfig(name)
 }
 
 //ApplicationConf returns application config
@@ -128,8 +314,7 @@ func ApplicationConf() *ApplicationConfig {
 
 //CollectApplicationSubmissionData returns user data related to
 //application submission in "ready to convert to json" format
-func CollectApplicationSubmissionData() []*Row {
-	userConf := UserConf()
+func CollectApplicationSubmissionData(userConf *UserConfig) []*Row {
 	applicationConf := ApplicationConf()
 	data := []*Row{}
 	strings := applicationConf.Strings
@@ -164,8 +349,7 @@ func CollectApplicationSubmissionData() []*Row {
 
 //CollectHeadOfDepartmentData returns user data related to
 //making reservation of a visit to head of department in "ready to convert to json" format
-func CollectHeadOfDepartmentData() []*Row {
-	userConf := UserConf()
+func CollectHeadOfDepartmentData(userConf *UserConfig) []*Row {
 	applicationConf := ApplicationConf()
 	data := []*Row{}
 	strings := applicationConf.Strings
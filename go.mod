@@ -1,9 +1,9 @@
 module github.com/dyrkin/rezerwacje-duw-go
 
 require (
+	github.com/andybalholm/brotli v1.0.4
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/ghodss/yaml v1.0.0
-	github.com/lunny/csession v0.0.0-20130910075847-fe53c5de3dfd
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/stretchr/testify v1.2.2 // indirect
 	github.com/tidwall/tinyqueue v0.0.0-20180302190814-1e39f5511563
@@ -1,16 +1,18 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
-	"net/url"
+	"io"
+	"os"
+	"os/signal"
 	"regexp"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/dyrkin/rezerwacje-duw-go/queue"
-
 	"github.com/dyrkin/rezerwacje-duw-go/captcha"
 	"github.com/dyrkin/rezerwacje-duw-go/cmd"
 	"github.com/dyrkin/rezerwacje-duw-go/config"
@@ -21,167 +23,266 @@ import (
 var dateEventsRegex = regexp.MustCompile("var dateEvents\\s+=\\s+(?P<Events>.*?);")
 var slotsRegex = regexp.MustCompile("lock\\(.*?>([\\d:]+)<\\/a>")
 
-var mutex = &sync.Mutex{}
+var proxyPool = newProxyPool()
 
-var client = session.New()
+var rateLimiter = newRateLimiter()
 
-var reservationQueue = queue.NewWithLimit(5)
+var warmupTimes = parseWarmupTimes()
 
-var https = config.ApplicationConf().Https
+var profileCounter uint32
 
-func extractLatestDate(entityHTML string) string {
-	groups := dateEventsRegex.FindStringSubmatch(entityHTML)
-	data := []byte(groups[1])
-	var values []map[string]string
-	json.Unmarshal(data, &values)
-	return values[len(values)-1]["date"]
-}
+var applicationConf = config.ApplicationConf()
 
-func extractTerms(termsHTML string) []string {
-	groups := slotsRegex.FindAllStringSubmatch(termsHTML, -1)
-	terms := []string{}
-	for _, group := range groups {
-		terms = append(terms, group[1])
-	}
-	return terms
-}
+var baseURL = applicationConf.Portal()
 
-func u(url string) string {
-	prefix := "http"
-	if https {
-		prefix = "https"
-	}
-	return fmt.Sprintf("%s://%s", prefix, url)
-}
+//endpoint classes requests are rate limited and timed out by
+const (
+	defaultEndpoint     = session.DefaultEndpoint
+	loginEndpoint       = "login"
+	termsEndpoint       = "terms"
+	captchaEndpoint     = "captcha"
+	lockEndpoint        = "lock"
+	reservationEndpoint = "reservation"
+)
 
-func acceptTerms(entity *config.Entity) {
-	url := u(fmt.Sprintf("rezerwacje.duw.pl/reservations/opmenus/terms/%s/%s?accepted=true", entity.Queue, entity.ID))
-	acceptTermsRequest := session.Get(url)
-	client.SafeSend(acceptTermsRequest).Drain()
+func timeout(kind string) time.Duration {
+	return applicationConf.Timeout(kind)
 }
 
-func latestDate(entity *config.Entity) string {
-	acceptTerms(entity)
-	url := u(fmt.Sprintf("rezerwacje.duw.pl/reservations/pol/queues/%s/%s", entity.Queue, entity.ID))
-	entityRequest := session.Get(url)
-	entityHTML := client.SafeSend(entityRequest).AsString()
-	return extractLatestDate(entityHTML)
+func newProxyPool() *session.ProxyPool {
+	proxies := applicationConf.Proxies
+	if len(proxies.URLs) == 0 {
+		return nil
+	}
+	pool, err := session.NewProxyPool(proxies.URLs)
+	if err != nil {
+		panic(fmt.Sprintf("Invalid proxies: %s", err))
+	}
+	if proxies.MaxFailures > 0 {
+		pool.MaxFailures = proxies.MaxFailures
+	}
+	if proxies.EjectFor.Duration > 0 {
+		pool.EjectFor = proxies.EjectFor.Duration
+	}
+	pool.TLSConfig = newTLSConfig()
+	return pool
 }
 
-func terms(entity *config.Entity, date string) []string {
-	url := u(fmt.Sprintf("rezerwacje.duw.pl/reservations/pol/queues/%s/%s/%s", entity.Queue, entity.ID, date))
-	headers := session.Headers{"X-Requested-With": "XMLHttpRequest"}
-	termsRequest := session.Get(url).Headers(headers)
-	termsHTML := client.SafeSend(termsRequest).AsString()
-	terms := extractTerms(termsHTML)
-	log.Infof("Available terms for %q: %q", entity.Name, terms)
-	return terms
+//newRateLimiter creates the rate limits shared by the sessions of all accounts, as they are sent from one IP
+func newRateLimiter() *session.RateLimiter {
+	limiter := session.NewRateLimiter()
+	for endpoint, limit := range applicationConf.RateLimits {
+		limiter.SetRateLimit(endpoint, session.RateLimit{Rate: limit.Rate, Burst: limit.Burst})
+	}
+	return limiter
 }
 
-func recognizeCaptcha() string {
-	captchaRequest := session.Get(u("rezerwacje.duw.pl/reservations/captcha"))
-	captchaImage := client.SafeSend(captchaRequest).AsBytes()
-	return captcha.RecognizeCaptcha(&captchaImage)
+//newTLSConfig creates TLS configuration of the sessions and of the proxy health checks
+func newTLSConfig() *tls.Config {
+	settings := applicationConf.TLS
+	tlsConfig, err := session.TLS{CABundle: settings.CABundle, Pins: settings.Pins, Insecure: settings.Insecure, Host: baseURL.Host}.Config()
+	if err != nil {
+		panic(fmt.Sprintf("Invalid tls settings: %s", err))
+	}
+	return tlsConfig
 }
 
-func checkCaptcha(captcha string) bool {
-	body := url.Values{"code": {captcha}}
-	checkCaptchaRequest := session.Post(u("rezerwacje.duw.pl/reservations/captcha/check")).Form(body)
-	result := client.SafeSend(checkCaptchaRequest).AsString()
-	return result == "true"
+func newClient() *session.Session {
+	options := []session.Option{session.WithTLS(newTLSConfig()), session.WithProfile(nextProfile()), session.WithRateLimiter(rateLimiter)}
+	if proxyPool != nil {
+		options = append(options, session.WithProxyPool(proxyPool))
+	}
+	client := session.New(options...)
+	if applicationConf.Language != "" {
+		client.Use(session.LanguageCookieMiddleware, session.LanguageCookie(applicationConf.Language))
+	}
+	return client
 }
 
-func renderUserDataToJSON(userData []*config.Row) string {
-	jsonBytes, _ := json.Marshal(userData)
-	return string(jsonBytes)
+//newSolver creates the chain of captcha solvers. Falls back to the template matcher if none is configured
+func newSolver(terminal *console) (captcha.Solver, error) {
+	settings := applicationConf.Captcha
+	loadCaptchaTemplates(settings.Templates)
+	names := settings.Solvers
+	if len(names) == 0 {
+		names = []string{"template"}
+	}
+	solvers := []captcha.Solver{}
+	for _, name := range names {
+		switch name {
+		case "template":
+			solvers = append(solvers, captcha.TemplateSolver{})
+		case "prompt":
+			prompt, err := captcha.NewPromptSolver(os.Stdout, terminal, settings.Timeout.Duration, captchaRendering())
+			if err != nil {
+				return nil, err
+			}
+			solvers = append(solvers, prompt)
+		case "http":
+			solvers = append(solvers, &captcha.HTTPSolver{URL: settings.URL, Timeout: settings.Timeout.Duration})
+		default:
+			return nil, fmt.Errorf("unsupported captcha solver [%s]", name)
+		}
+	}
+	return &captcha.ChainSolver{Solvers: solvers, Threshold: settings.Threshold}, nil
 }
 
-func postUserData(entity *config.Entity, slot string, userData *[]*config.Row) {
-	body := renderUserDataToJSON(*userData)
-	url := u(fmt.Sprintf("rezerwacje.duw.pl/reservations/reservations/updateFormData/%s/%s", slot, entity.ID))
-	headers := session.Headers{"Content-Type": "application/json; charset=utf-8"}
-	postUserDataRequest := session.Post(url).Body(body).Headers(headers)
-	client.SafeSend(postUserDataRequest).Drain()
+//newCaptchaArchive returns archive of solved captchas or nil if it is disabled
+func newCaptchaArchive() (*captcha.Archive, error) {
+	dir := applicationConf.Captcha.Archive
+	if dir == "" {
+		return nil, nil
+	}
+	archive, err := captcha.NewArchive(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create captcha archive: %s", err)
+	}
+	return archive, nil
 }
 
-func confirmTerm(entity *config.Entity, slot string) {
-	url := u(fmt.Sprintf("rezerwacje.duw.pl/reservations/reservations/reserv/%s/%s", slot, entity.ID))
-	confirmTermRequest := session.Get(url)
-	client.SafeSend(confirmTermRequest).Drain()
+//captchaRendering returns the way the captcha is shown in the terminal.
+//Unless configured, it is shown in colour, or saved to a file if the terminal has no colours
+func captchaRendering() string {
+	if render := applicationConf.Captcha.Render; render != "" {
+		return render
+	}
+	if _, noColor := os.LookupEnv("NO_COLOR"); noColor || os.Getenv("TERM") == "dumb" {
+		return captcha.RenderFile
+	}
+	return captcha.RenderColor
 }
 
-func reserve(entity *config.Entity, time string, slot string, userData *[]*config.Row) {
-	log.Infof("Attempt to make reservation for %q, slot %q and time %q", entity.Name, slot, time)
-	recognizedCaptcha := recognizeCaptcha()
-	log.Infof("Captcha value is %q", recognizedCaptcha)
-	if checkCaptcha(recognizedCaptcha) {
-		log.Infof("Captcha submitted successfully. Making reservation for %q, slot %q and time %q", entity.Name, slot, time)
-		postUserData(entity, slot, userData)
-		log.Infof("User data posted for %q, slot %q and time %q", entity.Name, slot, time)
-		confirmTerm(entity, slot)
-		log.Infof("Reservation completed for %q, slot %q and time %q. Check your email or DUW site", entity.Name, slot, time)
-	} else {
-		mutex.Unlock()
+//loadCaptchaTemplates replaces the embedded captcha templates with the trained ones.
+//The embedded templates stay in use if there is no template file or it is broken
+func loadCaptchaTemplates(path string) {
+	if path == "" {
+		return
+	}
+	err := captcha.LoadTemplates(path)
+	if err != nil && !os.IsNotExist(err) {
+		log.Infof("Unable to load captcha templates, the embedded ones are used: %s", err)
 	}
 }
 
-func tryLock(entity *config.Entity, time string) string {
-	lockResult := make(chan string)
-	for i := 0; i < 5; i++ {
-		go func() {
-			body := url.Values{"time": {time}, "queue": {entity.Queue}}
-			lockRequest := session.Post(u("rezerwacje.duw.pl/reservations/reservations/lock")).Form(body)
-			lockResult <- client.SafeSend(lockRequest).AsString()
-		}()
+//trainCaptcha builds captcha templates from the labelled captchas of the directory.
+//Digits without samples keep the templates currently in use
+func trainCaptcha(dir string, path string) error {
+	loadCaptchaTemplates(applicationConf.Captcha.Templates)
+	trainer := captcha.NewTrainer()
+	skipped, err := trainer.TrainDirectory(dir)
+	if err != nil {
+		return fmt.Errorf("unable to read labelled captchas: %s", err)
+	}
+	for _, reason := range skipped {
+		log.Infof("Skipped %s", reason)
+	}
+	if err := trainer.Save(path); err != nil {
+		return fmt.Errorf("unable to save captcha templates: %s", err)
 	}
-	return <-lockResult
+	log.Infof("Captcha templates saved to [%s]. Samples of digits 0-9: %v", path, trainer.Samples())
+	return nil
 }
 
-func lock(entity *config.Entity, time string) (slot string, locked bool) {
-	mutex.Lock()
-	log.Infof("Locking term %s for %q", time, entity.Name)
-	lockResult := tryLock(entity, time)
-	if strings.HasPrefix(lockResult, "OK") {
-		slot := lockResult[3:]
-		log.Infof("Term is locked. %q, time %q, slot %q", entity.Name, time, slot)
-		return slot, true
-	}
-	log.Infof("Unable to lock term %q for %q. Reason %q", time, entity.Name, lockResult)
-	mutex.Unlock()
-	return "", false
+//labelCaptchas asks for the answers of the archived captchas which were not accepted
+//and copies the labelled ones to the training directory
+func labelCaptchas(trainingDir string) error {
+	archive, err := newCaptchaArchive()
+	if err != nil {
+		return err
+	}
+	if archive == nil {
+		return fmt.Errorf("captcha archive is not configured")
+	}
+	entries, err := archive.Unlabelled()
+	if err != nil {
+		return fmt.Errorf("unable to read captcha archive: %s", err)
+	}
+	prompt, err := captcha.NewPromptSolver(os.Stdout, newConsole().lines, 0, captchaRendering())
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cancelOnInterrupt(ctx, cancel)
+	labelled := 0
+	for i, entry := range entries {
+		image, err := archive.Read(entry)
+		if err != nil {
+			log.Infof("Unable to read captcha [%s]: %s", entry.Image, err)
+			continue
+		}
+		fmt.Printf("Captcha %d of %d, %s, recognized as %q with confidence %.2f\n", i+1, len(entries), entry.Status, entry.Text, entry.Confidence)
+		answer, _, err := prompt.Solve(ctx, image)
+		if ctx.Err() != nil || err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Printf("Skipped: %s\n", err)
+			continue
+		}
+		if err := archive.Label(entry, answer, trainingDir); err != nil {
+			fmt.Printf("Skipped: %s\n", err)
+			continue
+		}
+		labelled++
+	}
+	log.Infof("%d captchas labelled and copied to [%s]. Run \"captcha train %s\" to build templates from them", labelled, trainingDir, trainingDir)
+	return nil
 }
 
-func initQueueProcessor() {
-	go func() {
-		for {
-			reservation := reservationQueue.Take()
-			time := fmt.Sprintf("%s %s:00", reservation.Date, reservation.Term)
-			if slot, ok := lock(reservation.Entity, time); ok {
-				reserve(reservation.Entity, time, slot, reservation.UserData)
-			}
+//nextProfile returns browser profile of a new session. Sessions take profiles in turn if rotation is enabled.
+//Falls back to the built-in profile if there are no profiles configured
+func nextProfile() session.Profile {
+	browser := applicationConf.Browser
+	profiles := applicationConf.Profiles
+	if len(profiles) == 0 {
+		return session.DefaultProfile()
+	}
+	profile := profiles[0]
+	if browser.Rotate {
+		next := atomic.AddUint32(&profileCounter, 1) - 1
+		profile = profiles[int(next)%len(profiles)]
+	} else if browser.Profile != "" {
+		found, ok := applicationConf.FindProfile(browser.Profile)
+		if !ok {
+			panic(fmt.Sprintf("Unsupported browser profile [%s]", browser.Profile))
 		}
-	}()
+		profile = found
+	}
+	headers := []session.Header{}
+	for _, header := range profile.Headers {
+		headers = append(headers, session.Header{Name: header.Name, Value: header.Value})
+	}
+	return session.Profile{Name: profile.Name, Headers: headers}
 }
 
-func scheduleReservation(entity *config.Entity, date string, term string, userData *[]*config.Row) {
-	reservation := &queue.Reservation{Entity: entity, Date: date, Term: term, UserData: userData}
-	reservationQueue.Push(reservation)
+func extractLatestDate(entityHTML string) (string, error) {
+	groups := dateEventsRegex.FindStringSubmatch(entityHTML)
+	if groups == nil {
+		return "", fmt.Errorf("Dates are not found on the page")
+	}
+	data := []byte(groups[1])
+	var values []map[string]string
+	if err := json.Unmarshal(data, &values); err != nil {
+		return "", err
+	}
+	if len(values) == 0 {
+		return "", fmt.Errorf("There are no dates on the page")
+	}
+	return values[len(values)-1]["date"], nil
 }
 
-func process(entity config.Entity, date string, userData *[]*config.Row) {
-	log.Infof("Scanning terms for %q and date %q", entity.Name, date)
-	terms := terms(&entity, date)
-	for _, term := range terms {
-		scheduleReservation(&entity, date, term, userData)
+func extractTerms(termsHTML string) []string {
+	groups := slotsRegex.FindAllStringSubmatch(termsHTML, -1)
+	terms := []string{}
+	for _, group := range groups {
+		terms = append(terms, group[1])
 	}
-	go process(entity, date, userData)
+	return terms
 }
 
-func login() bool {
-	body := url.Values{"data[User][email]": {config.UserConf().Login}, "data[User][password]": {config.UserConf().Password}}
-	loginRequest := session.Post(u("rezerwacje.duw.pl/reservations/pol/login")).Form(body)
-	loginResponse := client.SafeSend(loginRequest).Drain()
-	return loginResponse.Response.StatusCode != 200
+func u(path string) string {
+	return baseURL.URL(path)
 }
 
 func parseDate(dateStr string) time.Time {
@@ -205,6 +306,43 @@ func validDepartmentDate(date string) (time.Weekday, bool) {
 	return dayOfWeek, (dayOfWeek == time.Tuesday) || (dayOfWeek == time.Thursday)
 }
 
+//parseWarmupTimes parses the times of day connections are opened ahead of
+func parseWarmupTimes() []time.Time {
+	times := []time.Time{}
+	for _, clock := range applicationConf.Warmup.Times {
+		parsed, err := time.Parse("15:04:05", clock)
+		if err != nil {
+			panic(fmt.Sprintf("Invalid warmup time [%s], expected hh:mm:ss", clock))
+		}
+		times = append(times, parsed)
+	}
+	return times
+}
+
+//nextWarmupTime returns the closest of the given times of day whose warmup window is not over yet
+func nextWarmupTime(now time.Time, times []time.Time, lead time.Duration) (time.Time, bool) {
+	var next time.Time
+	for _, parsed := range times {
+		at := time.Date(now.Year(), now.Month(), now.Day(), parsed.Hour(), parsed.Minute(), parsed.Second(), 0, now.Location())
+		if !at.Add(lead).After(now) {
+			at = at.AddDate(0, 0, 1)
+		}
+		if next.IsZero() || at.Before(next) {
+			next = at
+		}
+	}
+	return next, !next.IsZero()
+}
+
+func sleepUntil(ctx context.Context, deadline time.Time) {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
 func findEntity(entities []*config.Entity, shortName string) (*config.Entity, bool) {
 	for _, entity := range entities {
 		if entity.ShortName == shortName {
@@ -214,93 +352,128 @@ func findEntity(entities []*config.Entity, shortName string) (*config.Entity, bo
 	return nil, false
 }
 
-func collectActiveEntities(entities []*config.Entity, validation func(date string) (time.Weekday, bool), failMessage string) map[*config.Entity]string {
-	entitiesToProcess := map[*config.Entity]string{}
-	for _, entity := range entities {
-		entityDate := latestDate(entity)
-		log.Infof("Validating current latest date %q for %q", entityDate, entity.Name)
-		if weekday, ok := validation(entityDate); ok {
-			log.Infof("Going to process %q for date %q", entity.Name, entityDate)
-			entitiesToProcess[entity] = entityDate
-		} else {
-			log.Infof(failMessage, entityDate, weekday, entity.Name)
-		}
-	}
-	return entitiesToProcess
+//console shares standard input between the captcha prompt and the keypress which stops the application
+type console struct {
+	lines   captcha.LineReader
+	answers chan string
 }
 
-func collectActiveDepartments(enabledDepartment string) map[*config.Entity]string {
-	if department, ok := findEntity(config.ApplicationConf().Departments, enabledDepartment); ok {
-		departments := []*config.Entity{department}
-		return collectActiveEntities(departments, validDepartmentDate,
-			"Date %q(%q) is wrong for %q because it is not Tuesday or Thursday")
+func newConsole() *console {
+	return &console{lines: captcha.NewLineReader(os.Stdin), answers: make(chan string)}
+}
+
+//ReadLine waits for the line typed while the captcha prompt is shown
+func (c *console) ReadLine(ctx context.Context) (string, error) {
+	select {
+	case answer := <-c.answers:
+		return answer, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
 	}
-	panic(fmt.Sprintf("Unsupported department [%s]", enabledDepartment))
 }
 
-func collectActiveCities(enabledCities []string) map[*config.Entity]string {
-	cities := []*config.Entity{}
-	if enabledCities != nil {
-		for _, enabledCity := range enabledCities {
-			if city, ok := findEntity(config.ApplicationConf().Cities, enabledCity); ok {
-				cities = append(cities, city)
-			} else {
-				panic(fmt.Sprintf("Unsupported city [%s]", enabledCity))
+//await blocks until the context is done or any key is pressed while no captcha prompt is shown
+func (c *console) await(ctx context.Context, cancel context.CancelFunc) {
+	go func() {
+		for {
+			line, err := c.lines.ReadLine(ctx)
+			if err != nil {
+				if err == io.EOF {
+					cancel()
+				}
+				return
+			}
+			select {
+			case c.answers <- line:
+			default:
+				cancel()
+				return
 			}
 		}
-	} else {
-		cities = config.ApplicationConf().Cities
-	}
-	return collectActiveEntities(cities, validCityDate,
-		"Date %q(%q) is wrong for %q because it is weekend")
+	}()
+	<-ctx.Done()
 }
 
-func await() {
-	var input string
-	fmt.Scanln(&input)
+//cancelOnInterrupt cancels the context when Ctrl+C is pressed
+func cancelOnInterrupt(ctx context.Context, cancel context.CancelFunc) {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	select {
+	case <-interrupt:
+		log.Infoln("Interrupted. Stopping...")
+		cancel()
+	case <-ctx.Done():
+	}
 }
 
-func processEntities(entities map[*config.Entity]string, userData []*config.Row) {
-	for i := 0; i < config.ApplicationConf().ParallelismFactor; i++ {
-		for entity, date := range entities {
-			go process(*entity, date, &userData)
-		}
+//book makes reservations for every account until they are made or a key is pressed
+func book(command string, args []string) error {
+	terminal := newConsole()
+	solver, err := newSolver(terminal)
+	if err != nil {
+		return err
+	}
+	archive, err := newCaptchaArchive()
+	if err != nil {
+		return err
 	}
-	await()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cancelOnInterrupt(ctx, cancel)
+	if interval := applicationConf.Proxies.HealthCheckInterval.Duration; proxyPool != nil && interval > 0 {
+		go proxyPool.HealthCheck(ctx, u("/"), interval)
+	}
+	userFiles := applicationConf.UserFiles()
+	wg := &sync.WaitGroup{}
+	for _, userFile := range userFiles {
+		b := newBooking(userFile, len(userFiles) > 1, solver, archive)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.run(ctx, command, args)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		cancel()
+	}()
+	terminal.await(ctx, cancel)
+	wg.Wait()
+	return nil
 }
 
-func processCommand(command string, args []string) {
+func processCommand(command string, args []string) error {
 	if command == cmd.HelpCommand {
 		fmt.Println("Help")
 		cmd.PrintHelp()
-	} else {
-		log.Infof("Logging in...")
-		if login() {
-			log.Infof("Successfully logged in")
-			var userData []*config.Row
-			var entities map[*config.Entity]string
-			switch command {
-			case cmd.ApplicationCommand:
-				userData = config.CollectApplicationSubmissionData()
-				enabledCities := args
-				entities = collectActiveCities(enabledCities)
-			case cmd.HeadofCommand:
-				userData = config.CollectHeadOfDepartmentData()
-				enabledDepartment := args[0]
-				entities = collectActiveDepartments(enabledDepartment)
-			}
-			initQueueProcessor()
-			processEntities(entities, userData)
-		} else {
-			log.Infoln("Invalid login or password")
+		return nil
+	} else if command == cmd.CaptchaCommand && args[0] == cmd.LabelSubcommand {
+		trainingDir := "captchas"
+		if len(args) > 1 {
+			trainingDir = args[1]
 		}
+		return labelCaptchas(trainingDir)
+	} else if command == cmd.CaptchaCommand {
+		path := applicationConf.Captcha.Templates
+		if len(args) > 2 {
+			path = args[2]
+		}
+		if path == "" {
+			path = "captcha-templates.png"
+		}
+		return trainCaptcha(args[1], path)
 	}
+	return book(command, args)
 }
 
 func main() {
 	command, args, err := cmd.ParseArgs()
 	if err == nil {
-		processCommand(command, args)
+		if err := processCommand(command, args); err != nil {
+			log.Infof("%s", err)
+			os.Exit(1)
+		}
 	} else {
 		fmt.Printf("%s\n", err)
 		cmd.PrintHelp()
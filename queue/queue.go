@@ -2,6 +2,7 @@ package queue
 
 import (
 	"container/heap"
+	"context"
 	"sync"
 	"time"
 
@@ -115,6 +116,8 @@ func (pq *priorityQueue) Index(reservation Reservation) int {
 func (q *ReservationQueue) Push(reservation *Reservation) {
 	q.pushLock.Lock()
 	defer q.pushLock.Unlock()
+	q.lock.Lock()
+	defer q.lock.Unlock()
 	if _, ok := q.items[*reservation]; ok {
 		q.update(reservation, q.pq.Index(*reservation))
 	} else {
@@ -144,10 +147,25 @@ func (q *ReservationQueue) Pop() *Reservation {
 	return q.pop()
 }
 
-func (q *ReservationQueue) Take() *Reservation {
+//Take waits for a reservation and pops it. Returns nil if the context is done before any reservation is pushed
+func (q *ReservationQueue) Take(ctx context.Context) *Reservation {
+	taken := make(chan struct{})
+	defer close(taken)
+	go func() {
+		select {
+		case <-ctx.Done():
+			q.lock.Lock()
+			q.nonEmptyCond.Broadcast()
+			q.lock.Unlock()
+		case <-taken:
+		}
+	}()
 	q.lock.Lock()
 	defer q.lock.Unlock()
 	for q.pq.Len() == 0 {
+		if ctx.Err() != nil {
+			return nil
+		}
 		q.nonEmptyCond.Wait()
 	}
 	return q.pop()
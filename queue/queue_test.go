@@ -1,6 +1,7 @@
 package queue
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
@@ -60,14 +61,32 @@ func (s *MySuite) TestTake(c *C) {
 		}
 	}()
 
-	c.Assert(queue.Take(), DeepEquals, &Reservation{Entity: entity, Date: "2017-07-20", Term: "13:20", UserData: &userData})
+	c.Assert(queue.Take(context.Background()), DeepEquals, &Reservation{Entity: entity, Date: "2017-07-20", Term: "13:20", UserData: &userData})
 	c.Assert(queue.Len(), Equals, 0)
-	c.Assert(queue.Take(), DeepEquals, &Reservation{Entity: entity, Date: "2017-07-21", Term: "13:20", UserData: &userData})
+	c.Assert(queue.Take(context.Background()), DeepEquals, &Reservation{Entity: entity, Date: "2017-07-21", Term: "13:20", UserData: &userData})
 	c.Assert(queue.Len(), Equals, 0)
-	c.Assert(queue.Take(), DeepEquals, &Reservation{Entity: entity, Date: "2017-07-22", Term: "13:20", UserData: &userData})
+	c.Assert(queue.Take(context.Background()), DeepEquals, &Reservation{Entity: entity, Date: "2017-07-22", Term: "13:20", UserData: &userData})
 	c.Assert(queue.Len(), Equals, 0)
 }
 
+func (s *MySuite) TestTakeIsCancelled(c *C) {
+	queue := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	taken := make(chan *Reservation)
+	go func() {
+		taken <- queue.Take(ctx)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	select {
+	case reservation := <-taken:
+		c.Assert(reservation, IsNil)
+	case <-time.After(time.Second):
+		c.Fatal("Take is not cancelled")
+	}
+}
+
 func (s *MySuite) TestLimit(c *C) {
 	queue := NewWithLimit(3)
 	userData := []*config.Row{&config.Row{Name: "hello", Value: "world"}}
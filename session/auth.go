@@ -0,0 +1,110 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dyrkin/rezerwacje-duw-go/log"
+)
+
+//ErrSessionExpired is returned when the portal session is still expired after logging in again
+var ErrSessionExpired = errors.New("portal session expired")
+
+//Reauthentication describes how an expired portal session is detected and renewed
+type Reauthentication struct {
+	//LoginPath is a path suffix of the login page the portal redirects to once the session expires
+	LoginPath string
+	//Markers are fragments of the login page body, e.g. the name of the password field
+	Markers []string
+	//Login logs the session in again. Requests sent with the given context are not checked for expiration
+	Login func(ctx context.Context) error
+}
+
+//reauthenticator serializes logins so parallel requests don't log in at the same time
+type reauthenticator struct {
+	*Reauthentication
+	lock       *sync.Mutex
+	generation uint64
+}
+
+type skipReauthenticationKey struct{}
+
+//WithoutReauthentication returns context whose requests are never treated as expired
+func WithoutReauthentication(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipReauthenticationKey{}, true)
+}
+
+func reauthenticationSkipped(ctx context.Context) bool {
+	skip, _ := ctx.Value(skipReauthenticationKey{}).(bool)
+	return skip
+}
+
+//SetReauthentication enables transparent login once the portal session expires. Nil disables it
+func (s *Session) SetReauthentication(reauthentication *Reauthentication) {
+	if reauthentication == nil {
+		s.reauth = nil
+		return
+	}
+	s.reauth = &reauthenticator{Reauthentication: reauthentication, lock: &sync.Mutex{}}
+}
+
+func (r *reauthenticator) currentGeneration() uint64 {
+	return atomic.LoadUint64(&r.generation)
+}
+
+//relogin logs in unless somebody else already did it after the given generation
+func (r *reauthenticator) relogin(ctx context.Context, generation uint64) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.currentGeneration() != generation {
+		return nil
+	}
+	log.Infof("Session expired. Logging in again...")
+	if err := r.Login(WithoutReauthentication(ctx)); err != nil {
+		return err
+	}
+	atomic.AddUint64(&r.generation, 1)
+	return nil
+}
+
+//expired tells whether the response is a redirect to the login page or the login page itself
+func (r *reauthenticator) expired(response *http.Response) bool {
+	switch response.StatusCode {
+	case http.StatusFound, http.StatusSeeOther, http.StatusMovedPermanently, http.StatusTemporaryRedirect:
+		location, err := response.Location()
+		return err == nil && r.LoginPath != "" && strings.HasSuffix(location.Path, r.LoginPath)
+	case http.StatusOK:
+		if len(r.Markers) == 0 || !strings.Contains(response.Header.Get("Content-Type"), "html") {
+			return false
+		}
+		body := peekBody(response)
+		for _, marker := range r.Markers {
+			if bytes.Contains(body, []byte(marker)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//peekBody reads response body and puts it back so it can be read again
+func peekBody(response *http.Response) []byte {
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body = &replayedBody{io.MultiReader(bytes.NewReader(body), response.Body), response.Body}
+	if err != nil {
+		return nil
+	}
+	return body
+}
+
+type replayedBody struct {
+	io.Reader
+	io.Closer
+}
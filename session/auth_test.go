@@ -0,0 +1,86 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type AuthSuite struct{}
+
+var _ = Suite(&AuthSuite{})
+
+func portal(loggedIn *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/pol/login" && r.Method == "POST":
+			time.Sleep(20 * time.Millisecond)
+			atomic.StoreInt32(loggedIn, 1)
+			http.Redirect(w, r, "/pol/queues", http.StatusFound)
+		case r.URL.Path == "/pol/login":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<input name="data[User][password]">`))
+		case atomic.LoadInt32(loggedIn) == 0:
+			http.Redirect(w, r, "/pol/login", http.StatusFound)
+		default:
+			w.Write([]byte("terms"))
+		}
+	}))
+}
+
+func (s *AuthSuite) TestReloginOnceForParallelRequests(c *C) {
+	var loggedIn int32
+	server := portal(&loggedIn)
+	defer server.Close()
+
+	var logins int32
+	client := New()
+	client.SetReauthentication(&Reauthentication{
+		LoginPath: "/pol/login",
+		Markers:   []string{"data[User][password]"},
+		Login: func(ctx context.Context) error {
+			atomic.AddInt32(&logins, 1)
+			response, err := client.SafeSendContext(ctx, Post(server.URL+"/pol/login"))
+			if err == nil {
+				response.Drain()
+			}
+			return err
+		},
+	})
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response, err := client.SafeSend(Get(server.URL + "/pol/queues/1"))
+			c.Check(err, IsNil)
+			c.Check(response.AsString(), Equals, "terms")
+		}()
+	}
+	wg.Wait()
+	c.Assert(atomic.LoadInt32(&logins), Equals, int32(1))
+}
+
+func (s *AuthSuite) TestLoginPageMarkers(c *C) {
+	var loggedIn int32
+	server := portal(&loggedIn)
+	defer server.Close()
+
+	client := New()
+	client.SetReauthentication(&Reauthentication{
+		Markers: []string{"data[User][password]"},
+		Login:   func(ctx context.Context) error { return nil },
+	})
+	_, err := client.SafeSend(Get(server.URL + "/pol/login"))
+	c.Assert(err, Equals, ErrSessionExpired)
+
+	response, err := client.SafeSendContext(WithoutReauthentication(context.Background()), Get(server.URL+"/pol/login"))
+	c.Assert(err, IsNil)
+	c.Assert(response.AsString(), Equals, `<input name="data[User][password]">`)
+}
@@ -0,0 +1,102 @@
+package session
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+//acceptedEncodings are content encodings the session asks for and decodes
+const acceptedEncodings = "gzip, deflate, br"
+
+//decodeContent replaces the body of the response encoded with gzip, deflate or brotli with the decoded one.
+//Transport doesn't do it by itself once Accept-Encoding header is set explicitly
+func decodeContent(response *http.Response) error {
+	encodings := contentEncodings(response.Header.Get("Content-Encoding"))
+	if len(encodings) == 0 {
+		return nil
+	}
+	body := response.Body
+	var reader io.Reader = body
+	//the last applied encoding is listed last, so it is removed first
+	for i := len(encodings) - 1; i >= 0; i-- {
+		switch encodings[i] {
+		case "gzip", "x-gzip":
+			gzipReader, err := gzip.NewReader(reader)
+			if err == io.EOF {
+				reader = strings.NewReader("")
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			reader = gzipReader
+		case "deflate":
+			reader = newDeflateReader(reader)
+		case "br":
+			reader = brotli.NewReader(reader)
+		case "identity":
+		default:
+			return fmt.Errorf("unsupported content encoding [%s]", encodings[i])
+		}
+	}
+	response.Body = &replayedBody{reader, body}
+	response.Header.Del("Content-Encoding")
+	response.Header.Del("Content-Length")
+	response.ContentLength = -1
+	response.Uncompressed = true
+	return nil
+}
+
+func contentEncodings(header string) []string {
+	encodings := []string{}
+	for _, encoding := range strings.Split(header, ",") {
+		encoding = strings.ToLower(strings.TrimSpace(encoding))
+		if encoding != "" {
+			encodings = append(encodings, encoding)
+		}
+	}
+	return encodings
+}
+
+//newDeflateReader reads deflate content with zlib header as the standard says
+//as well as raw deflate content some servers send instead
+func newDeflateReader(reader io.Reader) io.Reader {
+	buffered := bufio.NewReader(reader)
+	header, err := buffered.Peek(2)
+	if err != nil {
+		return buffered
+	}
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		zlibReader, err := zlib.NewReader(buffered)
+		if err != nil {
+			return &failingReader{err}
+		}
+		return zlibReader
+	}
+	return flate.NewReader(buffered)
+}
+
+//failingReader returns the error the body can't be decoded with on the first read
+type failingReader struct {
+	err error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+//closeWithError drains and closes the body which can't be decoded
+func closeWithError(response *http.Response, err error) (*http.Response, error) {
+	io.Copy(ioutil.Discard, response.Body)
+	response.Body.Close()
+	return nil, err
+}
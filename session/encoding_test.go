@@ -0,0 +1,88 @@
+package session
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/andybalholm/brotli"
+	. "gopkg.in/check.v1"
+)
+
+type EncodingSuite struct {
+	server *httptest.Server
+}
+
+var _ = Suite(&EncodingSuite{})
+
+const page = `<html><body>var dateEvents = [{"date":"2018-10-02"}];</body></html>`
+
+func encode(writer io.WriteCloser) {
+	writer.Write([]byte(page))
+	writer.Close()
+}
+
+func (s *EncodingSuite) SetUpSuite(c *C) {
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := &bytes.Buffer{}
+		encoding := r.URL.Path[1:]
+		switch encoding {
+		case "gzip":
+			encode(gzip.NewWriter(body))
+		case "deflate":
+			encode(zlib.NewWriter(body))
+		case "raw-deflate":
+			writer, _ := flate.NewWriter(body, flate.DefaultCompression)
+			encode(writer)
+			encoding = "deflate"
+		case "br":
+			encode(brotli.NewWriter(body))
+		case "redirect":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Header().Set("Location", "/gzip")
+			w.WriteHeader(http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Encoding", encoding)
+		w.Write(body.Bytes())
+	}))
+}
+
+func (s *EncodingSuite) TearDownSuite(c *C) {
+	s.server.Close()
+}
+
+func (s *EncodingSuite) TestDecoding(c *C) {
+	client := New()
+	for _, encoding := range []string{"gzip", "deflate", "raw-deflate", "br"} {
+		response, err := client.SafeSend(Get(s.server.URL + "/" + encoding))
+		c.Assert(err, IsNil)
+		c.Assert(response.Header.Get("Content-Encoding"), Equals, "")
+		text, err := response.Text()
+		c.Assert(err, IsNil, Commentf("encoding %s", encoding))
+		c.Assert(text, Equals, page, Commentf("encoding %s", encoding))
+	}
+}
+
+func (s *EncodingSuite) TestEmptyEncodedBody(c *C) {
+	response, err := New().SafeSend(Get(s.server.URL + "/redirect"))
+	c.Assert(err, IsNil)
+	c.Assert(response.ExpectStatus(http.StatusFound), IsNil)
+	c.Assert(response.AsString(), Equals, "")
+}
+
+func (s *EncodingSuite) TestAcceptEncoding(c *C) {
+	var acceptEncoding string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncoding = r.Header.Get("Accept-Encoding")
+	}))
+	defer server.Close()
+	response, err := New().SafeSend(Get(server.URL))
+	c.Assert(err, IsNil)
+	response.Drain()
+	c.Assert(acceptEncoding, Equals, "gzip, deflate, br")
+}
@@ -0,0 +1,141 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/dyrkin/rezerwacje-duw-go/log"
+)
+
+//PersistentJar is a cookie jar which can be saved to a file and restored from it
+type PersistentJar struct {
+	jar     *cookiejar.Jar
+	path    string
+	lock    *sync.Mutex
+	cookies map[string]*jarEntry
+}
+
+//jarEntry is a cookie together with the url it was received from
+type jarEntry struct {
+	URL    string       `json:"url"`
+	Cookie *http.Cookie `json:"cookie"`
+}
+
+//LoadJar creates jar bound to the given file and restores cookies from it.
+//Missing or corrupted file is not an error, the jar is just empty in this case and the next save replaces the file
+func LoadJar(path string) (*PersistentJar, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	pj := &PersistentJar{jar: jar, path: path, lock: &sync.Mutex{}, cookies: map[string]*jarEntry{}}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return pj, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []*jarEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		log.Errorf("Unable to restore cookies from %q, starting with no cookies\n%s", path, err)
+		return pj, nil
+	}
+	for _, entry := range entries {
+		u, err := url.Parse(entry.URL)
+		if err != nil || expired(entry.Cookie) {
+			continue
+		}
+		pj.SetCookies(u, []*http.Cookie{entry.Cookie})
+	}
+	return pj, nil
+}
+
+//SetCookies implements http.CookieJar
+func (pj *PersistentJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	pj.jar.SetCookies(u, cookies)
+	pj.lock.Lock()
+	defer pj.lock.Unlock()
+	origin := (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String()
+	for _, cookie := range cookies {
+		key := u.Hostname() + ";" + cookie.Domain + ";" + cookie.Path + ";" + cookie.Name
+		if cookie.MaxAge < 0 || expired(cookie) {
+			delete(pj.cookies, key)
+			continue
+		}
+		stored := *cookie
+		if cookie.MaxAge > 0 {
+			stored.Expires = time.Now().Add(time.Duration(cookie.MaxAge) * time.Second)
+			stored.MaxAge = 0
+		}
+		stored.Raw = ""
+		stored.Unparsed = nil
+		pj.cookies[key] = &jarEntry{URL: origin, Cookie: &stored}
+	}
+}
+
+//Cookies implements http.CookieJar
+func (pj *PersistentJar) Cookies(u *url.URL) []*http.Cookie {
+	return pj.jar.Cookies(u)
+}
+
+//Save writes cookies to the file readable by the owner only
+func (pj *PersistentJar) Save() error {
+	pj.lock.Lock()
+	entries := []*jarEntry{}
+	for _, entry := range pj.cookies {
+		if !expired(entry.Cookie) {
+			entries = append(entries, entry)
+		}
+	}
+	pj.lock.Unlock()
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(pj.path), filepath.Base(pj.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), pj.path)
+}
+
+//SaveEvery saves cookies with the given interval until the context is done
+func (pj *PersistentJar) SaveEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := pj.Save(); err != nil {
+				log.Errorf("Unable to save cookies to %q\n%s", pj.path, err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func expired(cookie *http.Cookie) bool {
+	return !cookie.Expires.IsZero() && cookie.Expires.Before(time.Now())
+}
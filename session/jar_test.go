@@ -0,0 +1,64 @@
+package session
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type JarSuite struct{}
+
+var _ = Suite(&JarSuite{})
+
+func (s *JarSuite) TestSaveAndLoad(c *C) {
+	path := filepath.Join(c.MkDir(), "cookies.json")
+	u, _ := url.Parse("https://rezerwacje.duw.pl/reservations/pol/login")
+
+	jar, err := LoadJar(path)
+	c.Assert(err, IsNil)
+	jar.SetCookies(u, []*http.Cookie{
+		{Name: "CAKEPHP", Value: "session", Path: "/"},
+		{Name: "expiring", Value: "soon", Path: "/", MaxAge: 3600},
+		{Name: "expired", Value: "gone", Path: "/", Expires: time.Now().Add(-time.Hour)},
+	})
+	c.Assert(jar.Save(), IsNil)
+
+	info, err := os.Stat(path)
+	c.Assert(err, IsNil)
+	c.Assert(info.Mode().Perm(), Equals, os.FileMode(0600))
+
+	restored, err := LoadJar(path)
+	c.Assert(err, IsNil)
+	cookies := map[string]string{}
+	for _, cookie := range restored.Cookies(u) {
+		cookies[cookie.Name] = cookie.Value
+	}
+	c.Assert(cookies, DeepEquals, map[string]string{"CAKEPHP": "session", "expiring": "soon"})
+}
+
+func (s *JarSuite) TestLoadMissingFile(c *C) {
+	jar, err := LoadJar(filepath.Join(c.MkDir(), "missing.json"))
+	c.Assert(err, IsNil)
+	u, _ := url.Parse("https://rezerwacje.duw.pl/")
+	c.Assert(jar.Cookies(u), HasLen, 0)
+}
+
+func (s *JarSuite) TestLoadCorruptedFile(c *C) {
+	path := filepath.Join(c.MkDir(), "cookies.json")
+	c.Assert(ioutil.WriteFile(path, []byte("not json"), 0600), IsNil)
+	jar, err := LoadJar(path)
+	c.Assert(err, IsNil)
+	u, _ := url.Parse("https://rezerwacje.duw.pl/")
+	c.Assert(jar.Cookies(u), HasLen, 0)
+
+	jar.SetCookies(u, []*http.Cookie{{Name: "CAKEPHP", Value: "session"}})
+	c.Assert(jar.Save(), IsNil)
+	restored, err := LoadJar(path)
+	c.Assert(err, IsNil)
+	c.Assert(restored.Cookies(u), HasLen, 1)
+}
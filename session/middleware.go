@@ -0,0 +1,152 @@
+package session
+
+import (
+	"net/http"
+	"sync"
+)
+
+//Middleware wraps the next round tripper of the chain, e.g. to add headers, log, measure or fail requests.
+//Middlewares see every request sent by the session, including the ones of retries and reauthentication
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+//Names of the middlewares the session is created with
+const (
+	BrowserHeadersMiddleware = "browserHeaders"
+	LanguageCookieMiddleware = "languageCookie"
+	RefererMiddleware        = "referer"
+	TraceMiddleware          = "trace"
+)
+
+type namedMiddleware struct {
+	name       string
+	middleware Middleware
+}
+
+//middlewareChain is an ordered list of middlewares. The first one sees the request first and the response last
+type middlewareChain struct {
+	lock        *sync.RWMutex
+	middlewares []namedMiddleware
+}
+
+func newMiddlewareChain() *middlewareChain {
+	return &middlewareChain{lock: &sync.RWMutex{}}
+}
+
+func (c *middlewareChain) use(name string, middleware Middleware) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for i, named := range c.middlewares {
+		if named.name == name {
+			c.middlewares[i].middleware = middleware
+			return
+		}
+	}
+	c.middlewares = append(c.middlewares, namedMiddleware{name, middleware})
+}
+
+func (c *middlewareChain) remove(names ...string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	kept := []namedMiddleware{}
+	for _, named := range c.middlewares {
+		if !contains(names, named.name) {
+			kept = append(kept, named)
+		}
+	}
+	c.middlewares = kept
+}
+
+func (c *middlewareChain) names() []string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	names := []string{}
+	for _, named := range c.middlewares {
+		names = append(names, named.name)
+	}
+	return names
+}
+
+//wrap builds the chain around the given round tripper
+func (c *middlewareChain) wrap(roundTripper http.RoundTripper) http.RoundTripper {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		roundTripper = c.middlewares[i].middleware(roundTripper)
+	}
+	return roundTripper
+}
+
+func contains(names []string, name string) bool {
+	for _, candidate := range names {
+		if candidate == name {
+			return true
+		}
+	}
+	return false
+}
+
+//Use adds the middleware to the end of the chain. Middleware with the same name is replaced in its place
+func (s *Session) Use(name string, middleware Middleware) {
+	s.middlewares.use(name, middleware)
+}
+
+//Remove removes middlewares with the given names from the chain, e.g. to turn off the default ones
+func (s *Session) Remove(names ...string) {
+	s.middlewares.remove(names...)
+}
+
+//Middlewares returns names of the middlewares in the order they see requests
+func (s *Session) Middlewares() []string {
+	return s.middlewares.names()
+}
+
+//BrowserHeaders makes requests look like the ones of the default browser profile. Headers set by the request itself are kept
+func BrowserHeaders() Middleware {
+	return BrowserProfile(DefaultProfile())
+}
+
+//LanguageCookie makes the portal answer in the given language, e.g. "pol"
+func LanguageCookie(lang string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+			request.AddCookie(&http.Cookie{Name: "config[lang]", Value: lang})
+			return next.RoundTrip(request)
+		})
+	}
+}
+
+//Referer sends the url of the previous request as Referer header the way a browser does
+func Referer() Middleware {
+	lock := &sync.Mutex{}
+	referer := ""
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+			lock.Lock()
+			if referer != "" && request.Header.Get("Referer") == "" {
+				request.Header.Set("Referer", referer)
+			}
+			lock.Unlock()
+			response, err := next.RoundTrip(request)
+			if err == nil {
+				lock.Lock()
+				referer = request.URL.String()
+				lock.Unlock()
+			}
+			return response, err
+		})
+	}
+}
+
+//Tracing writes requests and responses to the debug log according to the trace rules
+func Tracing(trace *Trace) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+			trace.traceRequest(request)
+			response, err := next.RoundTrip(request)
+			if err == nil {
+				trace.traceResponse(response)
+			}
+			return response, err
+		})
+	}
+}
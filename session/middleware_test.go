@@ -0,0 +1,110 @@
+package session
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	. "gopkg.in/check.v1"
+)
+
+type MiddlewareSuite struct{}
+
+var _ = Suite(&MiddlewareSuite{})
+
+func recordingServer(requests *[]*http.Request) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests = append(*requests, r)
+	}))
+}
+
+func (s *MiddlewareSuite) TestDefaultMiddlewares(c *C) {
+	var requests []*http.Request
+	server := recordingServer(&requests)
+	defer server.Close()
+	client := New()
+	c.Assert(client.Middlewares(), DeepEquals, []string{BrowserHeadersMiddleware, LanguageCookieMiddleware, RefererMiddleware, TraceMiddleware})
+
+	for _, path := range []string{"/first", "/second"} {
+		response, err := client.SafeSend(Get(server.URL + path).Headers(Headers{"Accept": "application/json"}))
+		c.Assert(err, IsNil)
+		response.Drain()
+	}
+	c.Assert(requests, HasLen, 2)
+	second := requests[1]
+	c.Assert(second.Header.Get("User-Agent"), Matches, ".*Chrome.*")
+	c.Assert(second.Header.Get("Accept"), Equals, "application/json")
+	c.Assert(second.Header.Get("Referer"), Equals, server.URL+"/first")
+	c.Assert(second.Header.Get("Cookie"), Equals, "config[lang]=pol")
+}
+
+func (s *MiddlewareSuite) TestDefaultsCanBeTurnedOff(c *C) {
+	var requests []*http.Request
+	server := recordingServer(&requests)
+	defer server.Close()
+	client := New()
+	client.Remove(BrowserHeadersMiddleware, LanguageCookieMiddleware)
+
+	response, err := client.SafeSend(Get(server.URL))
+	c.Assert(err, IsNil)
+	response.Drain()
+	c.Assert(requests[0].Header.Get("User-Agent"), Not(Matches), ".*Chrome.*")
+	c.Assert(requests[0].Header.Get("Cookie"), Equals, "")
+	c.Assert(client.Middlewares(), DeepEquals, []string{RefererMiddleware, TraceMiddleware})
+}
+
+func (s *MiddlewareSuite) TestOrderAndFaultInjection(c *C) {
+	var requests []*http.Request
+	server := recordingServer(&requests)
+	defer server.Close()
+	order := []string{}
+	named := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				return next.RoundTrip(request)
+			})
+		}
+	}
+	failures := 1
+	client := New()
+	client.SetRetryPolicy(fastRetry(3))
+	client.Use("first", named("first"))
+	client.Use("second", named("second"))
+	client.Use("faults", func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+			if failures > 0 {
+				failures--
+				return nil, errors.New("injected")
+			}
+			return next.RoundTrip(request)
+		})
+	})
+
+	response, err := client.SafeSend(Get(server.URL))
+	c.Assert(err, IsNil)
+	response.Drain()
+	c.Assert(order, DeepEquals, []string{"first", "second", "first", "second"})
+	c.Assert(requests, HasLen, 1)
+}
+
+func (s *MiddlewareSuite) TestProfile(c *C) {
+	var requests []*http.Request
+	server := recordingServer(&requests)
+	defer server.Close()
+	profile := Profile{Name: "firefox", Headers: []Header{
+		{"User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:131.0) Gecko/20100101 Firefox/131.0"},
+		{"Accept-Language", "pl,en-US;q=0.7,en;q=0.3"},
+		{"Accept-Encoding", "gzip, deflate, br, zstd"},
+	}}
+	client := New(WithProfile(profile))
+
+	response, err := client.SafeSend(Get(server.URL))
+	c.Assert(err, IsNil)
+	response.Drain()
+	c.Assert(requests[0].Header.Get("User-Agent"), Matches, ".*Firefox.*")
+	c.Assert(requests[0].Header.Get("Accept-Language"), Equals, "pl,en-US;q=0.7,en;q=0.3")
+	c.Assert(requests[0].Header.Get("Accept-Encoding"), Equals, "gzip, deflate, br")
+	c.Assert(requests[0].Header.Get("Accept"), Equals, "")
+	c.Assert(client.Middlewares()[0], Equals, BrowserHeadersMiddleware)
+}
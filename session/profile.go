@@ -0,0 +1,81 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+//Header is a single header of a browser profile
+type Header struct {
+	Name  string
+	Value string
+}
+
+//Profile is a set of headers a browser sends with every request, e.g. User-Agent, Accept-Language and sec-ch-ua headers.
+//Headers are listed in the order the browser sends them. net/http writes headers in its own order,
+//so the order is not kept on the wire, only traces dump the headers in the order of the profile
+type Profile struct {
+	Name    string
+	Headers []Header
+}
+
+//DefaultProfile is Chrome 69 on macOS the session presents itself as unless other profile is configured
+func DefaultProfile() Profile {
+	return Profile{
+		Name: "chrome69-mac",
+		Headers: []Header{
+			{"User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_14_0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/69.0.3497.100 Safari/537.36"},
+			{"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"},
+			{"Accept-Encoding", acceptedEncodings},
+			{"Accept-Language", "ru,en-US;q=0.9,en;q=0.8"},
+		},
+	}
+}
+
+//headerOrderKey is the context key of the names of the profile headers in the order the browser sends them
+type headerOrderKey struct{}
+
+//headerOrder returns the names of the profile headers of the request in the order the browser sends them
+func headerOrder(request *http.Request) []string {
+	names, _ := request.Context().Value(headerOrderKey{}).([]string)
+	return names
+}
+
+//BrowserProfile makes requests look like the ones of the browser described by the profile.
+//Headers set by the request itself are kept. Accept-Encoding is always the one the session can decode
+func BrowserProfile(profile Profile) Middleware {
+	headers := []Header{}
+	names := []string{}
+	encoding := false
+	for _, header := range profile.Headers {
+		if strings.EqualFold(header.Name, "Accept-Encoding") {
+			header.Value = acceptedEncodings
+			encoding = true
+		}
+		headers = append(headers, header)
+		names = append(names, http.CanonicalHeaderKey(header.Name))
+	}
+	if !encoding {
+		headers = append(headers, Header{"Accept-Encoding", acceptedEncodings})
+		names = append(names, "Accept-Encoding")
+	}
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+			for _, header := range headers {
+				if request.Header.Get(header.Name) == "" {
+					request.Header.Set(header.Name, header.Value)
+				}
+			}
+			request = request.WithContext(context.WithValue(request.Context(), headerOrderKey{}, names))
+			return next.RoundTrip(request)
+		})
+	}
+}
+
+//WithProfile makes the session present itself as the browser described by the profile
+func WithProfile(profile Profile) Option {
+	return func(s *Session) {
+		s.Use(BrowserHeadersMiddleware, BrowserProfile(profile))
+	}
+}
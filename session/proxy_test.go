@@ -0,0 +1,119 @@
+package session
+
+import (
+	"context"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type ProxySuite struct{}
+
+var _ = Suite(&ProxySuite{})
+
+//fakeProxy answers plain http requests sent through it with its own name
+func fakeProxy(name string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(name))
+	}))
+}
+
+func sendThrough(c *C, client *Session, ctx context.Context) string {
+	response, err := client.SafeSendContext(ctx, Get("http://rezerwacje.duw.pl/reservations/pol/login"))
+	c.Assert(err, IsNil)
+	return response.AsString()
+}
+
+func (s *ProxySuite) TestRotationAndStickiness(c *C) {
+	first, second := fakeProxy("first"), fakeProxy("second")
+	defer first.Close()
+	defer second.Close()
+	pool, err := NewProxyPool([]string{first.URL, second.URL})
+	c.Assert(err, IsNil)
+	client := New(WithProxyPool(pool))
+
+	ctx := context.Background()
+	c.Assert(sendThrough(c, client, ctx), Equals, "first")
+	c.Assert(sendThrough(c, client, ctx), Equals, "second")
+	c.Assert(sendThrough(c, client, ctx), Equals, "first")
+
+	sticky := WithStickyProxy(ctx)
+	pinned := sendThrough(c, client, sticky)
+	for i := 0; i < 3; i++ {
+		c.Assert(sendThrough(c, client, sticky), Equals, pinned)
+	}
+}
+
+func (s *ProxySuite) TestUnhealthyProxyIsEjected(c *C) {
+	alive, dead := fakeProxy("alive"), fakeProxy("dead")
+	defer alive.Close()
+	dead.Close()
+	pool, err := NewProxyPool([]string{dead.URL, alive.URL})
+	c.Assert(err, IsNil)
+	pool.MaxFailures = 1
+	pool.EjectFor = time.Hour
+	client := New(WithProxyPool(pool))
+	client.SetRetryPolicy(fastRetry(2))
+
+	for i := 0; i < 5; i++ {
+		c.Assert(sendThrough(c, client, context.Background()), Equals, "alive")
+	}
+}
+
+func (s *ProxySuite) TestUnsupportedScheme(c *C) {
+	_, err := NewProxyPool([]string{"ftp://10.0.0.1:21"})
+	c.Assert(err, NotNil)
+	_, err = NewProxyPool(nil)
+	c.Assert(err, Equals, ErrNoProxies)
+}
+
+//tunnelProxy tunnels CONNECT requests to their targets, the way proxies pass https through
+func tunnelProxy() *httptest.Server {
+	return httptest.NewServer(tunnel())
+}
+
+func tunnel() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		client, buffered, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			target.Close()
+			return
+		}
+		go func() {
+			io.Copy(target, buffered)
+			target.Close()
+		}()
+		io.Copy(client, target)
+		client.Close()
+	})
+}
+
+func (s *ProxySuite) TestProbeVerifiesTargetWithSessionTLS(c *C) {
+	portal := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer portal.Close()
+	proxy := tunnelProxy()
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+	bundle := filepath.Join(c.MkDir(), "ca.pem")
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: portal.Certificate().Raw})
+	c.Assert(ioutil.WriteFile(bundle, certificate, 0600), IsNil)
+	tlsConfig, err := TLS{CABundle: bundle}.Config()
+	c.Assert(err, IsNil)
+
+	c.Assert(probe(context.Background(), proxyURL, portal.URL, time.Second, nil), NotNil)
+	c.Assert(probe(context.Background(), proxyURL, portal.URL, time.Second, tlsConfig), IsNil)
+}
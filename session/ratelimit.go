@@ -0,0 +1,123 @@
+package session
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+//DefaultEndpoint is the endpoint class of requests without their own class
+const DefaultEndpoint = "default"
+
+//RateLimit is a number of requests per second with allowed burst
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+//tokenBucket makes requests wait for a token. Tokens are refilled with the constant rate up to the burst size
+type tokenBucket struct {
+	lock   *sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit) *tokenBucket {
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{lock: &sync.Mutex{}, rate: limit.Rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+//reserve takes a token and returns how long to wait until it is available
+func (b *tokenBucket) reserve() time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+//cancel returns the token which was not used
+func (b *tokenBucket) cancel() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.tokens++
+}
+
+func (b *tokenBucket) wait(ctx context.Context) error {
+	delay := b.reserve()
+	if delay == 0 {
+		return nil
+	}
+	if err := sleep(ctx, delay); err != nil {
+		b.cancel()
+		return err
+	}
+	return nil
+}
+
+//RateLimiter keeps token buckets of endpoint classes. Sessions sharing the limiter, see WithRateLimiter,
+//share its limits, so that requests of all accounts sent from one IP are limited together
+type RateLimiter struct {
+	buckets map[string]*tokenBucket
+	lock    *sync.RWMutex
+}
+
+//NewRateLimiter creates limiter without limits
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{buckets: map[string]*tokenBucket{}, lock: &sync.RWMutex{}}
+}
+
+//SetRateLimit limits requests of the given endpoint class. Requests wait for their turn rather than fail.
+//Limit of DefaultEndpoint applies to requests without their own class. Zero rate removes the limit
+func (l *RateLimiter) SetRateLimit(endpoint string, limit RateLimit) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if limit.Rate <= 0 {
+		delete(l.buckets, endpoint)
+		return
+	}
+	l.buckets[endpoint] = newTokenBucket(limit)
+}
+
+func (l *RateLimiter) wait(ctx context.Context, endpoint string) error {
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	l.lock.RLock()
+	bucket, ok := l.buckets[endpoint]
+	l.lock.RUnlock()
+	if !ok {
+		return nil
+	}
+	return bucket.wait(ctx)
+}
+
+//WithRateLimiter makes the session share the limits of the limiter with the other sessions using it
+func WithRateLimiter(limiter *RateLimiter) Option {
+	return func(s *Session) {
+		s.limiter = limiter
+	}
+}
+
+//SetRateLimit limits requests of the given endpoint class, see RateLimiter.SetRateLimit.
+//The limit applies to all sessions sharing the limiter of the session
+func (s *Session) SetRateLimit(endpoint string, limit RateLimit) {
+	s.limiter.SetRateLimit(endpoint, limit)
+}
+
+func (s *Session) waitForTurn(ctx context.Context, endpoint string) error {
+	return s.limiter.wait(ctx, endpoint)
+}
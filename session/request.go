@@ -1,10 +1,16 @@
 package session
 
 import (
-	"io"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"net/url"
 	"strings"
+	"time"
 )
 
 //Headers kay/value storage
@@ -13,122 +19,286 @@ type Headers map[string]string
 //Cookies kay/value storage
 type Cookies map[string]string
 
+//Builder builds http.Request
 type Builder interface {
-	Build() *http.Request
+	//Build returns a new request every time it is called, so the request can be sent again on retry
+	Build() (*http.Request, error)
+	//RetryPolicy returns request specific retry policy or nil if session policy should be used
+	RetryPolicy() *RetryPolicy
+	//RequestTimeout returns request specific deadline of a single attempt or zero if session timeout should be used
+	RequestTimeout() time.Duration
+	//EndpointClass returns the class of the endpoint the request is rate limited by
+	EndpointClass() string
 }
 
-//PostRequestBuilder is a post request builder interface
-type PostRequestBuilder interface {
-	Headers(headers Headers) PostRequestBuilder
-	Cookies(cookies Cookies) PostRequestBuilder
-	Form(body url.Values) PostRequestBuilder
-	Body(body string) PostRequestBuilder
-	Builder
+//requestOptions holds properties common for all request builders
+type requestOptions struct {
+	ctx      context.Context
+	retry    *RetryPolicy
+	timeout  time.Duration
+	endpoint string
 }
 
-type postRequest struct {
-	request func(body io.Reader, headers Headers, cookies Cookies) *http.Request
-	body    io.Reader
-	headers Headers
-	cookies Cookies
+//RequestBuilder builds request of any method. Headers, cookies and query parameters are added to the ones set before
+type RequestBuilder interface {
+	Method(method string) RequestBuilder
+	Query(query url.Values) RequestBuilder
+	Header(name string, value string) RequestBuilder
+	Headers(headers Headers) RequestBuilder
+	Cookie(name string, value string) RequestBuilder
+	Cookies(cookies Cookies) RequestBuilder
+	Form(body url.Values) RequestBuilder
+	Body(body string) RequestBuilder
+	JSON(v interface{}) RequestBuilder
+	Multipart(fields url.Values, files ...MultipartFile) RequestBuilder
+	Retry(policy *RetryPolicy) RequestBuilder
+	Timeout(timeout time.Duration) RequestBuilder
+	WithContext(ctx context.Context) RequestBuilder
+	Endpoint(class string) RequestBuilder
+	Builder
 }
 
 //GetRequestBuilder is a get request builder interface
-type GetRequestBuilder interface {
-	Headers(headers Headers) GetRequestBuilder
-	Cookies(cookies Cookies) GetRequestBuilder
-	Builder
+type GetRequestBuilder = RequestBuilder
+
+//PostRequestBuilder is a post request builder interface
+type PostRequestBuilder = RequestBuilder
+
+//MultipartFile is a file uploaded in multipart/form-data body
+type MultipartFile struct {
+	//Field is the name of the form field
+	Field string
+	//Name is the name of the file
+	Name string
+	//ContentType defaults to application/octet-stream
+	ContentType string
+	Content     []byte
 }
 
-type getRequest struct {
-	request func(headers Headers, cookies Cookies) *http.Request
-	headers Headers
-	cookies Cookies
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+type request struct {
+	method      string
+	url         string
+	query       url.Values
+	header      http.Header
+	cookies     []*http.Cookie
+	body        []byte
+	contentType string
+	err         error
+	requestOptions
+}
+
+func newRequest(method string, address string) *request {
+	return &request{method: method, url: address, query: url.Values{}, header: http.Header{}}
+}
+
+//Request creates request of the given method
+func Request(method string, url string) RequestBuilder {
+	return newRequest(method, url)
 }
 
 //Get creates get request
 func Get(url string) GetRequestBuilder {
-	pr := &getRequest{}
-	pr.request = func(headers Headers, cookies Cookies) *http.Request {
-		req, _ := http.NewRequest("GET", url, nil)
-		setHeaders(req, headers)
-		setCookies(req, cookies)
-		return req
-	}
-	return pr
+	return newRequest("GET", url)
 }
 
-//Post creates post request
+//Post creates post request. Body is sent as url encoded form unless other content type is set
 func Post(url string) PostRequestBuilder {
-	pr := &postRequest{}
-	pr.request = func(body io.Reader, headers Headers, cookies Cookies) *http.Request {
-		req, _ := http.NewRequest("POST", url, body)
-		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-		setHeaders(req, headers)
-		setCookies(req, cookies)
-		return req
-	}
+	pr := newRequest("POST", url)
+	pr.body = []byte{}
+	pr.contentType = "application/x-www-form-urlencoded"
 	return pr
 }
 
-//Headers adds headers to post request
-func (pr *postRequest) Headers(headers Headers) PostRequestBuilder {
-	pr.headers = headers
-	return pr
+//Method changes method of the request
+func (r *request) Method(method string) RequestBuilder {
+	r.method = method
+	return r
 }
 
-//Headers adds headers to get request
-func (pr *getRequest) Headers(headers Headers) GetRequestBuilder {
-	pr.headers = headers
-	return pr
+//Query adds parameters to the query of the request url
+func (r *request) Query(query url.Values) RequestBuilder {
+	for name, values := range query {
+		for _, value := range values {
+			r.query.Add(name, value)
+		}
+	}
+	return r
 }
 
-//Cookies adds cookies to post request
-func (pr *postRequest) Cookies(cookies Cookies) PostRequestBuilder {
-	pr.cookies = cookies
-	return pr
+//Header adds header to the request
+func (r *request) Header(name string, value string) RequestBuilder {
+	r.header.Add(name, value)
+	return r
 }
 
-//Cookies adds cookies to get request
-func (pr *getRequest) Cookies(cookies Cookies) GetRequestBuilder {
-	pr.cookies = cookies
-	return pr
+//Headers sets headers of the request keeping the other headers set before
+func (r *request) Headers(headers Headers) RequestBuilder {
+	for name, value := range headers {
+		r.header.Set(name, value)
+	}
+	return r
 }
 
-//Form represents key/value post request body
-func (pr *postRequest) Form(body url.Values) PostRequestBuilder {
-	pr.body = strings.NewReader(body.Encode())
-	return pr
+//Cookie adds cookie to the request
+func (r *request) Cookie(name string, value string) RequestBuilder {
+	r.cookies = append(r.cookies, &http.Cookie{Name: name, Value: value})
+	return r
 }
 
-//Body represents simple string post request body
-func (pr *postRequest) Body(body string) PostRequestBuilder {
-	pr.body = strings.NewReader(body)
-	return pr
+//Cookies adds cookies to the request
+func (r *request) Cookies(cookies Cookies) RequestBuilder {
+	for name, value := range cookies {
+		r.Cookie(name, value)
+	}
+	return r
+}
+
+//Retry overrides session retry policy for the request
+func (r *request) Retry(policy *RetryPolicy) RequestBuilder {
+	r.retry = policy
+	return r
+}
+
+//Timeout overrides session deadline of a single attempt for the request
+func (r *request) Timeout(timeout time.Duration) RequestBuilder {
+	r.timeout = timeout
+	return r
 }
 
-//Build builds http.Request from PartialRequest
-func (pr *postRequest) Build() *http.Request {
-	return pr.request(pr.body, pr.headers, pr.cookies)
+//WithContext binds the request to the given context
+func (r *request) WithContext(ctx context.Context) RequestBuilder {
+	r.ctx = ctx
+	return r
 }
 
-//Build builds http.Request from PartialRequest
-func (pr *getRequest) Build() *http.Request {
-	return pr.request(pr.headers, pr.cookies)
+//Endpoint sets the class of the endpoint the request is rate limited by, e.g. "terms"
+func (r *request) Endpoint(class string) RequestBuilder {
+	r.endpoint = class
+	return r
 }
 
-func setHeaders(request *http.Request, headers Headers) {
-	if headers != nil {
-		for name, value := range headers {
-			request.Header.Set(name, value)
+//Form represents key/value request body
+func (r *request) Form(body url.Values) RequestBuilder {
+	r.body = []byte(body.Encode())
+	r.contentType = "application/x-www-form-urlencoded"
+	return r
+}
+
+//Body represents simple string request body
+func (r *request) Body(body string) RequestBuilder {
+	r.body = []byte(body)
+	return r
+}
+
+//JSON represents request body encoded to json. Encoding error is returned by Build
+func (r *request) JSON(v interface{}) RequestBuilder {
+	body, err := json.Marshal(v)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	r.body = body
+	r.contentType = "application/json; charset=utf-8"
+	return r
+}
+
+//Multipart represents multipart/form-data request body with the given fields and files
+func (r *request) Multipart(fields url.Values, files ...MultipartFile) RequestBuilder {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for name, values := range fields {
+		for _, value := range values {
+			if err := writer.WriteField(name, value); err != nil {
+				r.err = err
+				return r
+			}
 		}
 	}
+	for _, file := range files {
+		contentType := file.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, quoteEscaper.Replace(file.Field), quoteEscaper.Replace(file.Name)))
+		header.Set("Content-Type", contentType)
+		part, err := writer.CreatePart(header)
+		if err == nil {
+			_, err = part.Write(file.Content)
+		}
+		if err != nil {
+			r.err = err
+			return r
+		}
+	}
+	if err := writer.Close(); err != nil {
+		r.err = err
+		return r
+	}
+	r.body = body.Bytes()
+	r.contentType = writer.FormDataContentType()
+	return r
 }
 
-func setCookies(request *http.Request, cookies Cookies) {
-	if cookies != nil {
-		for name, value := range cookies {
-			request.AddCookie(&http.Cookie{Name: name, Value: value})
+//Build builds http.Request. Returns an error if the url, the method or the body is invalid
+func (r *request) Build() (*http.Request, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	requestURL, err := url.Parse(r.url)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.query) > 0 {
+		query := requestURL.Query()
+		for name, values := range r.query {
+			for _, value := range values {
+				query.Add(name, value)
+			}
 		}
+		requestURL.RawQuery = query.Encode()
+	}
+	var req *http.Request
+	if r.body != nil {
+		req, err = http.NewRequestWithContext(r.context(), r.method, requestURL.String(), bytes.NewReader(r.body))
+	} else {
+		req, err = http.NewRequestWithContext(r.context(), r.method, requestURL.String(), nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r.body != nil && r.contentType != "" {
+		req.Header.Set("Content-Type", r.contentType)
+	}
+	for name, values := range r.header {
+		req.Header[name] = append([]string(nil), values...)
+	}
+	for _, cookie := range r.cookies {
+		req.AddCookie(cookie)
+	}
+	return req, nil
+}
+
+//RetryPolicy returns retry policy of the request
+func (o *requestOptions) RetryPolicy() *RetryPolicy {
+	return o.retry
+}
+
+//RequestTimeout returns deadline of a single attempt of the request
+func (o *requestOptions) RequestTimeout() time.Duration {
+	return o.timeout
+}
+
+//EndpointClass returns the class of the endpoint the request is rate limited by
+func (o *requestOptions) EndpointClass() string {
+	return o.endpoint
+}
+
+func (o *requestOptions) context() context.Context {
+	if o.ctx == nil {
+		return context.Background()
 	}
+	return o.ctx
 }
@@ -0,0 +1,70 @@
+package session
+
+import (
+	"io/ioutil"
+	"net/url"
+
+	. "gopkg.in/check.v1"
+)
+
+type RequestSuite struct{}
+
+var _ = Suite(&RequestSuite{})
+
+func (s *RequestSuite) TestHeadersCookiesAndQueryAreAdded(c *C) {
+	request, err := Get("http://rezerwacje.duw.pl/opmenus/terms/17/1?accepted=true").
+		Headers(Headers{"X-Requested-With": "XMLHttpRequest"}).
+		Headers(Headers{"Accept": "text/html"}).
+		Header("Accept-Language", "pl").
+		Cookies(Cookies{"first": "1"}).
+		Cookie("second", "2").
+		Query(url.Values{"page": {"2"}}).
+		Build()
+	c.Assert(err, IsNil)
+	c.Assert(request.Method, Equals, "GET")
+	c.Assert(request.Header.Get("X-Requested-With"), Equals, "XMLHttpRequest")
+	c.Assert(request.Header.Get("Accept"), Equals, "text/html")
+	c.Assert(request.Header.Get("Accept-Language"), Equals, "pl")
+	c.Assert(request.Cookies(), HasLen, 2)
+	c.Assert(request.URL.Query(), DeepEquals, url.Values{"accepted": {"true"}, "page": {"2"}})
+}
+
+func (s *RequestSuite) TestJSON(c *C) {
+	request, err := Request("PUT", "http://rezerwacje.duw.pl/reservations/1").JSON(map[string]string{"name": "value"}).Build()
+	c.Assert(err, IsNil)
+	c.Assert(request.Method, Equals, "PUT")
+	c.Assert(request.Header.Get("Content-Type"), Equals, "application/json; charset=utf-8")
+	body, _ := ioutil.ReadAll(request.Body)
+	c.Assert(string(body), Equals, `{"name":"value"}`)
+
+	_, err = Post("http://rezerwacje.duw.pl/").JSON(make(chan int)).Build()
+	c.Assert(err, NotNil)
+}
+
+func (s *RequestSuite) TestMultipart(c *C) {
+	file := MultipartFile{Field: "document", Name: "passport.pdf", ContentType: "application/pdf", Content: []byte("%PDF")}
+	request, err := Post("http://rezerwacje.duw.pl/upload").Multipart(url.Values{"id": {"7"}}, file).Build()
+	c.Assert(err, IsNil)
+	c.Assert(request.ParseMultipartForm(1024), IsNil)
+	c.Assert(request.MultipartForm.Value["id"], DeepEquals, []string{"7"})
+	header := request.MultipartForm.File["document"][0]
+	c.Assert(header.Filename, Equals, "passport.pdf")
+	c.Assert(header.Header.Get("Content-Type"), Equals, "application/pdf")
+}
+
+func (s *RequestSuite) TestBodyIsResentOnEveryBuild(c *C) {
+	builder := Post("http://rezerwacje.duw.pl/captcha/check").Form(url.Values{"code": {"123456"}})
+	for i := 0; i < 2; i++ {
+		request, err := builder.Build()
+		c.Assert(err, IsNil)
+		body, _ := ioutil.ReadAll(request.Body)
+		c.Assert(string(body), Equals, "code=123456")
+	}
+}
+
+func (s *RequestSuite) TestInvalidRequest(c *C) {
+	_, err := Get("http://rezerwacje.duw.pl/%zz").Build()
+	c.Assert(err, NotNil)
+	_, err = Request("BAD METHOD", "http://rezerwacje.duw.pl/").Build()
+	c.Assert(err, NotNil)
+}
@@ -0,0 +1,88 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+//ErrEmptyBody is returned when the response has no body, but the caller expects one
+var ErrEmptyBody = errors.New("response body is empty")
+
+//StatusError is returned when the response has unexpected status code
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected response status [%s]", e.Status)
+}
+
+//TruncatedBodyError is returned when the response body can't be read to the end,
+//e.g. the connection is dropped or the attempt times out in the middle of the body
+type TruncatedBodyError struct {
+	//Read is the number of bytes received before the failure
+	Read int
+	//Expected is the declared length of the body or -1 if it is unknown
+	Expected int64
+	Err      error
+}
+
+func (e *TruncatedBodyError) Error() string {
+	if e.Expected < 0 {
+		return fmt.Sprintf("response body is truncated after %d bytes: %s", e.Read, e.Err)
+	}
+	return fmt.Sprintf("response body is truncated after %d of %d bytes: %s", e.Read, e.Expected, e.Err)
+}
+
+func (e *TruncatedBodyError) Unwrap() error {
+	return e.Err
+}
+
+//ExpectStatus returns StatusError and drains the body if status code of the response is not one of the given ones.
+//Any 2xx status code is expected if none is given
+func (r *Response) ExpectStatus(statusCodes ...int) error {
+	if len(statusCodes) == 0 && r.StatusCode >= 200 && r.StatusCode < 300 {
+		return nil
+	}
+	for _, statusCode := range statusCodes {
+		if r.StatusCode == statusCode {
+			return nil
+		}
+	}
+	r.Drain()
+	return &StatusError{StatusCode: r.StatusCode, Status: r.Status}
+}
+
+//Bytes reads the body of 2xx response. Returns StatusError, ErrEmptyBody or TruncatedBodyError otherwise
+func (r *Response) Bytes() ([]byte, error) {
+	if err := r.ExpectStatus(); err != nil {
+		return nil, err
+	}
+	defer r.Response.Body.Close()
+	body, err := ioutil.ReadAll(r.Response.Body)
+	if err != nil {
+		return nil, &TruncatedBodyError{Read: len(body), Expected: r.ContentLength, Err: err}
+	}
+	if len(body) == 0 {
+		return nil, ErrEmptyBody
+	}
+	return body, nil
+}
+
+//Text reads the body of 2xx response as string
+func (r *Response) Text() (string, error) {
+	body, err := r.Bytes()
+	return string(body), err
+}
+
+//JSON decodes the body of 2xx response to the given value
+func (r *Response) JSON(v interface{}) error {
+	body, err := r.Bytes()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,69 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "gopkg.in/check.v1"
+)
+
+type ResponseSuite struct {
+	server *httptest.Server
+}
+
+var _ = Suite(&ResponseSuite{})
+
+func (s *ResponseSuite) SetUpSuite(c *C) {
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/json":
+			w.Write([]byte(`{"date":"2018-10-02"}`))
+		case "/html":
+			w.Write([]byte(`<html><body><a href="#">10:15</a></body></html>`))
+		case "/empty":
+		case "/truncated":
+			w.Header().Set("Content-Length", "100")
+			w.Write([]byte("OK:"))
+		case "/moved":
+			http.Redirect(w, r, "/html", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func (s *ResponseSuite) TearDownSuite(c *C) {
+	s.server.Close()
+}
+
+func (s *ResponseSuite) get(c *C, path string) *Response {
+	response, err := New().SafeSend(Get(s.server.URL + path).Retry(NoRetry()))
+	c.Assert(err, IsNil)
+	return response
+}
+
+func (s *ResponseSuite) TestJSON(c *C) {
+	var value map[string]string
+	c.Assert(s.get(c, "/json").JSON(&value), IsNil)
+	c.Assert(value["date"], Equals, "2018-10-02")
+}
+
+func (s *ResponseSuite) TestUnexpectedStatus(c *C) {
+	_, err := s.get(c, "/missing").Text()
+	c.Assert(err, FitsTypeOf, &StatusError{})
+	c.Assert(err.(*StatusError).StatusCode, Equals, http.StatusNotFound)
+	c.Assert(s.get(c, "/moved").ExpectStatus(http.StatusFound), IsNil)
+	c.Assert(s.get(c, "/moved").ExpectStatus(), NotNil)
+}
+
+func (s *ResponseSuite) TestEmptyBody(c *C) {
+	_, err := s.get(c, "/empty").Text()
+	c.Assert(err, Equals, ErrEmptyBody)
+}
+
+func (s *ResponseSuite) TestTruncatedBody(c *C) {
+	_, err := s.get(c, "/truncated").Text()
+	c.Assert(err, FitsTypeOf, &TruncatedBodyError{})
+	c.Assert(err.(*TruncatedBodyError).Read, Equals, 3)
+	c.Assert(err.(*TruncatedBodyError).Expected, Equals, int64(100))
+}
@@ -0,0 +1,112 @@
+package session
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+//RetryPolicy describes how many times and how often a failed request is repeated
+type RetryPolicy struct {
+	//MaxAttempts is the total number of attempts including the first one
+	MaxAttempts int
+	//InitialBackoff is the delay before the second attempt
+	InitialBackoff time.Duration
+	//MaxBackoff caps the exponentially growing delay
+	MaxBackoff time.Duration
+	//Multiplier is the factor the delay grows by after every attempt
+	Multiplier float64
+	//Jitter is the fraction of the delay which is randomized in both directions. Must be in [0, 1]
+	Jitter float64
+	//RetryOnError decides whether the request failed with the given error is worth repeating
+	RetryOnError func(err error) bool
+	//RetryOnStatus decides whether the request answered with the given status code is worth repeating
+	RetryOnStatus func(statusCode int) bool
+}
+
+//RetryError is returned when the retry policy gives up
+type RetryError struct {
+	//Attempts is the number of attempts made
+	Attempts int
+	//StatusCode is the status code of the last response if the last attempt got one
+	StatusCode int
+	//Err is the error of the last attempt if the last attempt failed
+	Err error
+}
+
+func (e *RetryError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("request failed after %d attempt(s): %s", e.Attempts, e.Err)
+	}
+	return fmt.Sprintf("request failed after %d attempt(s): status code %d", e.Attempts, e.StatusCode)
+}
+
+//Unwrap returns the error of the last attempt
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+//DefaultRetryPolicy returns policy which makes up to 5 attempts with exponential backoff
+//and repeats requests failed with any error or answered with 502, 503 or 504
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 200 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		RetryOnError:   AnyError,
+		RetryOnStatus:  StatusCodes(502, 503, 504),
+	}
+}
+
+//NoRetry returns policy which makes exactly one attempt
+func NoRetry() *RetryPolicy {
+	return &RetryPolicy{MaxAttempts: 1}
+}
+
+//AnyError is a RetryOnError predicate which repeats a request on any error
+func AnyError(err error) bool {
+	return err != nil
+}
+
+//StatusCodes returns RetryOnStatus predicate which repeats a request answered with one of the given status codes
+func StatusCodes(statusCodes ...int) func(statusCode int) bool {
+	return func(statusCode int) bool {
+		for _, code := range statusCodes {
+			if code == statusCode {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (p *RetryPolicy) retryError(err error) bool {
+	return p.RetryOnError != nil && p.RetryOnError(err)
+}
+
+func (p *RetryPolicy) retryStatus(statusCode int) bool {
+	return p.RetryOnStatus != nil && p.RetryOnStatus(statusCode)
+}
+
+func (p *RetryPolicy) exhausted(attempt int) bool {
+	return attempt >= p.MaxAttempts
+}
+
+//Backoff returns the delay to wait after the given attempt. Attempts are counted from 1
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	delay := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(delay)
+}
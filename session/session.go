@@ -1,17 +1,15 @@
 package session
 
 import (
+	"context"
 	"crypto/tls"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/cookiejar"
-	"net/http/httputil"
 	"time"
 
 	"github.com/dyrkin/rezerwacje-duw-go/log"
-
-	"github.com/lunny/csession"
 )
 
 //Response wraps http.Response to add new functionality
@@ -19,13 +17,40 @@ type Response struct {
 	*http.Response
 }
 
-//Session the same as csession.Session, but I wan't to add additional functionality to it
+//Session is http.Client which keeps cookies, retries failed requests and passes them through the middleware chain
 type Session struct {
-	*csession.Session
+	*http.Client
+	retryPolicy *RetryPolicy
+	timeout     time.Duration
+	reauth      *reauthenticator
+	transport   http.RoundTripper
+	limiter     *RateLimiter
+	proxies     *ProxyPool
+	middlewares *middlewareChain
+	connections *connectionTracker
+	warmup      *warmupTracker
+	tlsConfig   *tls.Config
+}
+
+//Option configures session created by New
+type Option func(s *Session)
+
+//WithProxyPool makes the session rotate requests through the proxies of the pool
+func WithProxyPool(pool *ProxyPool) Option {
+	return func(s *Session) {
+		s.proxies = pool
+	}
+}
+
+//roundTripperFunc is an adapter to use ordinary functions as http.RoundTripper
+type roundTripperFunc func(request *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(request *http.Request) (*http.Response, error) {
+	return f(request)
 }
 
 //New creates new session
-func New() *Session {
+func New(options ...Option) *Session {
 	jar, err := cookiejar.New(nil)
 	if err != nil {
 		jar = nil
@@ -33,46 +58,210 @@ func New() *Session {
 	dontFollowRedirects := func(req *http.Request, via []*http.Request) error {
 		return http.ErrUseLastResponse
 	}
-	transport := http.DefaultTransport.(*http.Transport)
-	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-	transport.MaxIdleConnsPerHost = 30
-	transport.TLSHandshakeTimeout = 10 * time.Second
-	session := &Session{}
-	session.Session = csession.NewSession(transport, dontFollowRedirects, jar)
-	session.Session.HeadersFunc = func(req *http.Request) {
-		csession.DefaultHeadersFunc(req)
-		userAgent := "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_14_0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/69.0.3497.100 Safari/537.36"
-		encoding := "gzip, deflate"
-		acceptLanguage := "ru,en-US;q=0.9,en;q=0.8"
-		lang := "pol"
-		req.Header.Set("User-Agent", userAgent)
-		req.Header.Set("Accept-Encoding", encoding)
-		req.Header.Set("Accept-Language", acceptLanguage)
-		req.AddCookie(&http.Cookie{Name: "config[lang]", Value: lang})
+	session := &Session{
+		retryPolicy: DefaultRetryPolicy(),
+		middlewares: newMiddlewareChain(),
+		connections: newConnectionTracker(),
+		warmup:      newWarmupTracker(),
+		limiter:     NewRateLimiter(),
+	}
+	session.Use(BrowserHeadersMiddleware, BrowserHeaders())
+	session.Use(LanguageCookieMiddleware, LanguageCookie("pol"))
+	session.Use(RefererMiddleware, Referer())
+	session.Use(TraceMiddleware, Tracing(DefaultTrace()))
+	for _, option := range options {
+		option(session)
+	}
+	transport := newTransport(session.tlsConfig)
+	if session.proxies != nil {
+		transport.Proxy = session.proxies.proxyFor
+	}
+	session.transport = transport
+	session.Client = &http.Client{
+		Transport:     roundTripperFunc(session.roundTrip),
+		CheckRedirect: dontFollowRedirects,
+		Jar:           jar,
 	}
 	return session
 }
 
+//roundTrip passes the request through the middleware chain
+func (s *Session) roundTrip(request *http.Request) (*http.Response, error) {
+	return s.middlewares.wrap(roundTripperFunc(s.send)).RoundTrip(request)
+}
+
+//send sends the request through the transport and decodes content of the response
+func (s *Session) send(request *http.Request) (*http.Response, error) {
+	request = s.track(request)
+	var response *http.Response
+	var err error
+	if s.proxies != nil {
+		response, err = s.proxies.sendThroughProxy(request, s.transport.RoundTrip)
+	} else {
+		response, err = s.transport.RoundTrip(request)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := decodeContent(response); err != nil {
+		return closeWithError(response, err)
+	}
+	return response, nil
+}
+
 //Send simply sends http request
 func (s *Session) Send(request *http.Request) (*http.Response, error) {
-	debugHTTP("Sending request:\n%s\n", request)
 	resp, err := s.Do(request)
-	if err == nil {
-		debugHTTP("Received response:\n%s\n", resp)
-	} else {
+	if err != nil {
 		log.Errorf("Received error:\n%s", err)
 	}
 	return resp, err
 }
 
-//SafeSend safely sends http request. In case of error it tries again
-func (s *Session) SafeSend(requestBuilder Builder) *Response {
-	response, err := s.Send(requestBuilder.Build())
+//SendContext sends http request bound to the given context
+func (s *Session) SendContext(ctx context.Context, request *http.Request) (*http.Response, error) {
+	return s.Send(request.WithContext(ctx))
+}
+
+//SetRetryPolicy sets retry policy used by SafeSend for requests without their own policy
+func (s *Session) SetRetryPolicy(policy *RetryPolicy) {
+	s.retryPolicy = policy
+}
+
+//SetJar replaces cookie jar of the session
+func (s *Session) SetJar(jar http.CookieJar) {
+	s.Jar = jar
+}
+
+//SetTimeout sets deadline of a single attempt for requests without their own timeout. Zero means no deadline
+func (s *Session) SetTimeout(timeout time.Duration) {
+	s.timeout = timeout
+}
+
+func (s *Session) policyFor(requestBuilder Builder) *RetryPolicy {
+	if policy := requestBuilder.RetryPolicy(); policy != nil {
+		return policy
+	}
+	if s.retryPolicy != nil {
+		return s.retryPolicy
+	}
+	return NoRetry()
+}
+
+func (s *Session) timeoutFor(requestBuilder Builder) time.Duration {
+	if timeout := requestBuilder.RequestTimeout(); timeout > 0 {
+		return timeout
+	}
+	return s.timeout
+}
+
+//SafeSend safely sends http request bound to the context of the builder.
+//In case of error it tries again according to the retry policy and returns an error once the policy gives up
+func (s *Session) SafeSend(requestBuilder Builder) (*Response, error) {
+	return s.safeSend(nil, requestBuilder)
+}
+
+//SafeSendContext is the same as SafeSend, but the request and the delays between attempts are bound to the given context.
+//Response body must be read or closed before the context is cancelled
+func (s *Session) SafeSendContext(ctx context.Context, requestBuilder Builder) (*Response, error) {
+	return s.safeSend(ctx, requestBuilder)
+}
+
+func (s *Session) safeSend(ctx context.Context, requestBuilder Builder) (*Response, error) {
+	policy := s.policyFor(requestBuilder)
+	timeout := s.timeoutFor(requestBuilder)
+	reauthenticated := false
+	for attempt := 1; ; attempt++ {
+		request, err := requestBuilder.Build()
+		if err != nil {
+			return nil, err
+		}
+		if ctx == nil {
+			ctx = request.Context()
+		}
+		reauth := s.reauth
+		if reauth != nil && reauthenticationSkipped(ctx) {
+			reauth = nil
+		}
+		var generation uint64
+		if reauth != nil {
+			generation = reauth.currentGeneration()
+		}
+		if err := s.waitForTurn(ctx, requestBuilder.EndpointClass()); err != nil {
+			return nil, err
+		}
+		response, err := s.sendAttempt(ctx, request, timeout)
+		if err == nil && reauth != nil && reauth.expired(response) {
+			(&Response{response}).Drain()
+			if reauthenticated {
+				return nil, ErrSessionExpired
+			}
+			if err := reauth.relogin(ctx, generation); err != nil {
+				return nil, err
+			}
+			reauthenticated = true
+			attempt--
+			continue
+		}
+		if err == nil && !policy.retryStatus(response.StatusCode) {
+			return &Response{response}, nil
+		}
+		retryErr := &RetryError{Attempts: attempt, Err: err}
+		if err == nil {
+			retryErr.StatusCode = response.StatusCode
+			(&Response{response}).Drain()
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil && !policy.retryError(err) {
+			return nil, retryErr
+		}
+		if policy.exhausted(attempt) {
+			return nil, retryErr
+		}
+		backoff := policy.Backoff(attempt)
+		log.Errorf("Error occurred while sending request. Try again in %s\n%s", backoff, retryErr)
+		if err := sleep(ctx, backoff); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (s *Session) sendAttempt(ctx context.Context, request *http.Request, timeout time.Duration) (*http.Response, error) {
+	if timeout <= 0 {
+		return s.SendContext(ctx, request)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	response, err := s.SendContext(ctx, request)
 	if err != nil {
-		log.Errorf("Error occurred while sending request. Try again\n%s", err)
-		return s.SafeSend(requestBuilder)
+		cancel()
+		return nil, err
+	}
+	response.Body = &cancelOnClose{response.Body, cancel}
+	return response, nil
+}
+
+//cancelOnClose releases the context of a single attempt when response body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+func sleep(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	return &Response{response}
 }
 
 //AsString converts http response to string
@@ -80,7 +269,7 @@ func (r *Response) AsString() string {
 	return string(r.AsBytes())
 }
 
-//AsBytes converts http response to byte array
+//AsBytes converts http response to byte array. Reading is interrupted once the request context is done
 func (r *Response) AsBytes() []byte {
 	defer r.Response.Body.Close()
 	resp, _ := ioutil.ReadAll(r.Response.Body)
@@ -92,19 +281,3 @@ func (r *Response) Drain() *Response {
 	io.Copy(ioutil.Discard, r.Response.Body)
 	return r
 }
-
-func debugHTTP(format string, r interface{}) {
-	var bytes []byte
-	var err error
-	switch r := r.(type) {
-	case *http.Request:
-		bytes, err = httputil.DumpRequest(r, true)
-	case *http.Response:
-		bytes, err = httputil.DumpResponse(r, true)
-	}
-	if err == nil {
-		log.Debugf(format, string(bytes))
-	} else {
-		log.Errorf(format, err)
-	}
-}
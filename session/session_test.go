@@ -0,0 +1,199 @@
+package session
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type SessionSuite struct{}
+
+var _ = Suite(&SessionSuite{})
+
+func fastRetry(maxAttempts int) *RetryPolicy {
+	policy := DefaultRetryPolicy()
+	policy.MaxAttempts = maxAttempts
+	policy.InitialBackoff = time.Millisecond
+	return policy
+}
+
+func (s *SessionSuite) TestSafeSendRetriesStatus(c *C) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("OK"))
+	}))
+	defer server.Close()
+
+	client := New()
+	client.SetRetryPolicy(fastRetry(5))
+	response, err := client.SafeSend(Get(server.URL))
+	c.Assert(err, IsNil)
+	c.Assert(response.AsString(), Equals, "OK")
+	c.Assert(atomic.LoadInt32(&calls), Equals, int32(3))
+}
+
+func (s *SessionSuite) TestSafeSendGivesUp(c *C) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	client := New()
+	client.SetRetryPolicy(fastRetry(5))
+	_, err := client.SafeSend(Get(server.URL).Retry(fastRetry(2)))
+	c.Assert(err, FitsTypeOf, &RetryError{})
+	c.Assert(err.(*RetryError).Attempts, Equals, 2)
+	c.Assert(err.(*RetryError).StatusCode, Equals, http.StatusBadGateway)
+	c.Assert(atomic.LoadInt32(&calls), Equals, int32(2))
+}
+
+func (s *SessionSuite) TestSafeSendRetriesError(c *C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	client := New()
+	_, err := client.SafeSend(Post(url).Body("body").Retry(fastRetry(3)))
+	c.Assert(err, FitsTypeOf, &RetryError{})
+	c.Assert(err.(*RetryError).Attempts, Equals, 3)
+	c.Assert(err.(*RetryError).Err, NotNil)
+}
+
+func (s *SessionSuite) TestPostBodyIsResentOnRetry(c *C) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusGatewayTimeout)
+			return
+		}
+		w.Write([]byte(r.PostForm.Get("code")))
+	}))
+	defer server.Close()
+
+	client := New()
+	response, err := client.SafeSend(Post(server.URL).Form(map[string][]string{"code": {"123456"}}).Retry(fastRetry(2)))
+	c.Assert(err, IsNil)
+	c.Assert(response.AsString(), Equals, "123456")
+}
+
+func (s *SessionSuite) TestSafeSendContextCancelled(c *C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := fastRetry(10)
+	policy.InitialBackoff = time.Hour
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	_, err := New().SafeSendContext(ctx, Get(server.URL).Retry(policy))
+	c.Assert(err, Equals, context.Canceled)
+}
+
+func (s *SessionSuite) TestSafeSendTimeout(c *C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	started := time.Now()
+	_, err := New().SafeSend(Get(server.URL).Retry(NoRetry()).Timeout(50 * time.Millisecond))
+	c.Assert(err, NotNil)
+	c.Assert(time.Since(started) < time.Second, Equals, true)
+}
+
+func (s *SessionSuite) TestRateLimit(c *C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client := New()
+	client.SetRateLimit("terms", RateLimit{Rate: 20, Burst: 1})
+	started := time.Now()
+	for i := 0; i < 5; i++ {
+		response, err := client.SafeSend(Get(server.URL).Endpoint("terms"))
+		c.Assert(err, IsNil)
+		response.Drain()
+	}
+	c.Assert(time.Since(started) >= 200*time.Millisecond, Equals, true)
+
+	started = time.Now()
+	for i := 0; i < 5; i++ {
+		response, err := client.SafeSend(Get(server.URL).Endpoint("lock"))
+		c.Assert(err, IsNil)
+		response.Drain()
+	}
+	c.Assert(time.Since(started) < 200*time.Millisecond, Equals, true)
+}
+
+func (s *SessionSuite) TestSharedRateLimiter(c *C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	limiter := NewRateLimiter()
+	limiter.SetRateLimit("terms", RateLimit{Rate: 20, Burst: 1})
+	clients := []*Session{New(WithRateLimiter(limiter)), New(WithRateLimiter(limiter))}
+	started := time.Now()
+	for i := 0; i < 6; i++ {
+		response, err := clients[i%2].SafeSend(Get(server.URL).Endpoint("terms"))
+		c.Assert(err, IsNil)
+		response.Drain()
+	}
+	c.Assert(time.Since(started) >= 250*time.Millisecond, Equals, true)
+}
+
+//closeRecorder tells whether the body was closed
+type closeRecorder struct {
+	io.ReadCloser
+	closed bool
+}
+
+func (r *closeRecorder) Close() error {
+	r.closed = true
+	return r.ReadCloser.Close()
+}
+
+func (s *SessionSuite) TestRetryableResponseIsClosedWhenCancelled(c *C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	body := &closeRecorder{}
+	client := New()
+	client.Use("cancel", func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+			response, err := next.RoundTrip(request)
+			if err == nil {
+				body.ReadCloser = response.Body
+				response.Body = body
+			}
+			cancel()
+			return response, err
+		})
+	})
+	_, err := client.SafeSendContext(ctx, Get(server.URL).Retry(fastRetry(3)))
+	c.Assert(err, Equals, context.Canceled)
+	c.Assert(body.closed, Equals, true)
+}
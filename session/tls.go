@@ -0,0 +1,128 @@
+package session
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dyrkin/rezerwacje-duw-go/log"
+)
+
+//ErrCertificateNotPinned is returned when none of the certificates presented by the server matches the pins
+var ErrCertificateNotPinned = errors.New("certificate of the server doesn't match any of the pins")
+
+//TLS represents settings of verification of the server certificate. Zero value verifies it against the system roots
+type TLS struct {
+	//CABundle is a path to PEM file with certificates trusted in addition to the system roots
+	CABundle string
+	//Pins are base64 encoded SHA-256 hashes of the public keys the certificate chain of the server must contain one of.
+	//The hash of a certificate is printed by:
+	//openssl x509 -in cert.pem -pubkey -noout | openssl pkey -pubin -outform der | openssl dgst -sha256 -binary | base64
+	Pins []string
+	//Insecure disables verification of the certificate. Pins are still checked
+	Insecure bool
+	//Host is the server the pins apply to, so that certificates of other servers, e.g. https proxies, are not pinned.
+	//Empty host applies the pins to every server
+	Host string
+}
+
+//Config creates tls.Config with the settings
+func (t TLS) Config() (*tls.Config, error) {
+	config := &tls.Config{}
+	if t.CABundle != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		bundle, err := ioutil.ReadFile(t.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("no certificates found in [%s]", t.CABundle)
+		}
+		config.RootCAs = pool
+	}
+	if t.Insecure {
+		log.Infof("WARNING: verification of the server certificate is disabled. Connection can be intercepted")
+		config.InsecureSkipVerify = true
+	}
+	if len(t.Pins) > 0 {
+		pins := map[string]bool{}
+		for _, pin := range t.Pins {
+			hash, err := base64.StdEncoding.DecodeString(pin)
+			if err != nil || len(hash) != sha256.Size {
+				return nil, fmt.Errorf("invalid pin [%s]", pin)
+			}
+			pins[string(hash)] = true
+		}
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			if !t.pinned(state.ServerName) {
+				return nil
+			}
+			return verifyPins(pins, state.PeerCertificates)
+		}
+	}
+	return config, nil
+}
+
+//pinned tells whether the pins apply to the server of the given name. Servers addressed by IP don't send their name,
+//so pins of the host given by IP apply to every server addressed by IP
+func (t TLS) pinned(serverName string) bool {
+	if t.Host == "" {
+		return true
+	}
+	host := t.Host
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	if net.ParseIP(host) != nil {
+		return serverName == ""
+	}
+	return strings.EqualFold(strings.TrimSuffix(host, "."), serverName)
+}
+
+//verifyPins checks the certificates presented by the server. They are verified by the time it is called unless verification is disabled
+func verifyPins(pins map[string]bool, certs []*x509.Certificate) error {
+	for _, cert := range certs {
+		hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		if pins[string(hash[:])] {
+			return nil
+		}
+	}
+	return ErrCertificateNotPinned
+}
+
+//WithTLS makes the session verify the server certificate with the given config instead of the default one
+func WithTLS(config *tls.Config) Option {
+	return func(s *Session) {
+		s.tlsConfig = config
+	}
+}
+
+//newTransport creates transport owned by the session. HTTP/2 is negotiated if the server supports it.
+//http.DefaultTransport is shared by the whole process, so it is never changed
+func newTransport(tlsConfig *tls.Config) *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   30,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		ForceAttemptHTTP2:     true,
+	}
+}
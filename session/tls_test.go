@@ -0,0 +1,133 @@
+package session
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type TLSSuite struct {
+	server *httptest.Server
+}
+
+var _ = Suite(&TLSSuite{})
+
+func (s *TLSSuite) SetUpSuite(c *C) {
+	s.server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secure"))
+	}))
+}
+
+func (s *TLSSuite) TearDownSuite(c *C) {
+	s.server.Close()
+}
+
+func (s *TLSSuite) send(c *C, settings TLS) error {
+	config, err := settings.Config()
+	c.Assert(err, IsNil)
+	response, err := New(WithTLS(config)).SafeSend(Get(s.server.URL).Retry(NoRetry()))
+	if err == nil {
+		response.Drain()
+	}
+	return err
+}
+
+func (s *TLSSuite) pin() string {
+	hash := sha256.Sum256(s.server.Certificate().RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+func (s *TLSSuite) TestCertificateIsVerifiedByDefault(c *C) {
+	c.Assert(s.send(c, TLS{}), NotNil)
+	defaultConfig := http.DefaultTransport.(*http.Transport).TLSClientConfig
+	c.Assert(defaultConfig == nil || !defaultConfig.InsecureSkipVerify, Equals, true)
+}
+
+func (s *TLSSuite) TestCABundle(c *C) {
+	bundle := filepath.Join(c.MkDir(), "ca.pem")
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.server.Certificate().Raw})
+	c.Assert(ioutil.WriteFile(bundle, certificate, 0600), IsNil)
+	c.Assert(s.send(c, TLS{CABundle: bundle}), IsNil)
+}
+
+func (s *TLSSuite) TestPinning(c *C) {
+	c.Assert(s.send(c, TLS{Insecure: true, Pins: []string{s.pin()}}), IsNil)
+	wrongPin := base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+	c.Assert(s.send(c, TLS{Insecure: true, Pins: []string{wrongPin}}), NotNil)
+	_, err := TLS{Pins: []string{"not a pin"}}.Config()
+	c.Assert(err, NotNil)
+}
+
+func (s *TLSSuite) TestInsecureOptIn(c *C) {
+	c.Assert(s.send(c, TLS{Insecure: true}), IsNil)
+}
+
+//newCertificate creates self-signed certificate of localhost with its own key
+func newCertificate(c *C) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	raw, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	c.Assert(err, IsNil)
+	return tls.Certificate{Certificate: [][]byte{raw}, PrivateKey: key}
+}
+
+func (s *TLSSuite) TestPinsApplyToHostOnly(c *C) {
+	certificate := newCertificate(c)
+	portal := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secure"))
+	}))
+	portal.TLS = &tls.Config{Certificates: []tls.Certificate{certificate}}
+	portal.StartTLS()
+	defer portal.Close()
+	proxy := httptest.NewUnstartedServer(tunnel())
+	proxy.StartTLS()
+	defer proxy.Close()
+	portalURL := strings.Replace(portal.URL, "127.0.0.1", "localhost", 1)
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	c.Assert(err, IsNil)
+	hash := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+	pin := base64.StdEncoding.EncodeToString(hash[:])
+	send := func(pins ...string) error {
+		config, err := TLS{Insecure: true, Pins: pins, Host: "localhost"}.Config()
+		c.Assert(err, IsNil)
+		pool, err := NewProxyPool([]string{proxy.URL})
+		c.Assert(err, IsNil)
+		response, err := New(WithTLS(config), WithProxyPool(pool)).SafeSend(Get(portalURL).Retry(NoRetry()))
+		if err == nil {
+			response.Drain()
+		}
+		return err
+	}
+
+	c.Assert(send(pin), IsNil)
+	c.Assert(send(s.pin()), NotNil)
+}
+
+func (s *TLSSuite) TestPinnedServer(c *C) {
+	c.Assert(TLS{}.pinned("proxy.example.com"), Equals, true)
+	c.Assert(TLS{Host: "rezerwacje.duw.pl"}.pinned("rezerwacje.duw.pl"), Equals, true)
+	c.Assert(TLS{Host: "rezerwacje.duw.pl:443"}.pinned("Rezerwacje.duw.pl"), Equals, true)
+	c.Assert(TLS{Host: "rezerwacje.duw.pl"}.pinned("proxy.example.com"), Equals, false)
+	c.Assert(TLS{Host: "rezerwacje.duw.pl"}.pinned(""), Equals, false)
+	c.Assert(TLS{Host: "10.0.0.1:8443"}.pinned(""), Equals, true)
+}
@@ -0,0 +1,216 @@
+package session
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/dyrkin/rezerwacje-duw-go/log"
+)
+
+//Trace describes what is written to the debug log about every request and response.
+//Redaction rules are matched case-insensitively, so the log can be attached to a bug report
+type Trace struct {
+	//Bodies enables dumping of request and response bodies. Only the start line and headers are dumped otherwise
+	Bodies bool
+	//Headers are names of headers whose values are redacted. Cookie names are kept
+	Headers []string
+	//FormFields are names of url encoded form fields and query parameters whose values are redacted
+	FormFields []string
+	//JSONKeys are keys of json objects whose values are redacted at any depth
+	JSONKeys []string
+}
+
+//DefaultTrace dumps bodies and redacts credentials, cookies and personal data sent to the portal
+func DefaultTrace() *Trace {
+	return &Trace{
+		Bodies:     true,
+		Headers:    []string{"Cookie", "Set-Cookie", "Authorization", "Proxy-Authorization"},
+		FormFields: []string{"data[User][email]", "data[User][password]"},
+		JSONKeys:   []string{"value"},
+	}
+}
+
+//SetTrace replaces rules of tracing requests and responses to the debug log. Nil disables tracing
+func (s *Session) SetTrace(trace *Trace) {
+	if trace == nil {
+		s.Remove(TraceMiddleware)
+		return
+	}
+	s.Use(TraceMiddleware, Tracing(trace))
+}
+
+func (t *Trace) traceRequest(request *http.Request) {
+	log.Debugf("Sending request:\n%s", t.dumpRequest(request))
+}
+
+func (t *Trace) traceResponse(response *http.Response) {
+	log.Debugf("Received response:\n%s", t.dumpResponse(response))
+}
+
+func (t *Trace) dumpRequest(request *http.Request) string {
+	dump := &bytes.Buffer{}
+	target := request.URL.Path
+	if request.URL.RawQuery != "" {
+		query, err := url.ParseQuery(request.URL.RawQuery)
+		if err == nil {
+			target += "?" + t.redactForm(query).Encode()
+		} else {
+			target += "?" + redacted
+		}
+	}
+	fmt.Fprintf(dump, "%s %s %s\n", request.Method, target, request.Proto)
+	fmt.Fprintf(dump, "Host: %s\n", request.URL.Host)
+	t.dumpHeaders(dump, request.Header, headerOrder(request))
+	if t.Bodies && request.GetBody != nil {
+		body, err := request.GetBody()
+		if err == nil {
+			content, _ := ioutil.ReadAll(body)
+			body.Close()
+			t.dumpBody(dump, request.Header, content)
+		}
+	}
+	return dump.String()
+}
+
+func (t *Trace) dumpResponse(response *http.Response) string {
+	dump := &bytes.Buffer{}
+	fmt.Fprintf(dump, "%s %s\n", response.Proto, response.Status)
+	t.dumpHeaders(dump, response.Header, nil)
+	if !t.Bodies {
+		return dump.String()
+	}
+	//bodies which are only described are not read, so tracing doesn't delay their readers
+	description := describeBody(response.Header)
+	switch {
+	case description == "":
+		t.dumpBody(dump, response.Header, peekBody(response))
+	case response.ContentLength > 0:
+		fmt.Fprintf(dump, "\n[%d bytes %s]\n", response.ContentLength, description)
+	case response.ContentLength < 0:
+		fmt.Fprintf(dump, "\n[body of unknown length %s]\n", description)
+	}
+	return dump.String()
+}
+
+//dumpHeaders dumps the headers named in order first in that order, then the rest of them sorted by name
+func (t *Trace) dumpHeaders(dump *bytes.Buffer, header http.Header, order []string) {
+	names := []string{}
+	for name := range header {
+		if !contains(order, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range append(append([]string{}, order...), names...) {
+		for _, value := range header[name] {
+			fmt.Fprintf(dump, "%s: %s\n", name, t.redactHeader(name, value))
+		}
+	}
+}
+
+func (t *Trace) redactHeader(name string, value string) string {
+	if !matches(t.Headers, name) {
+		return value
+	}
+	switch http.CanonicalHeaderKey(name) {
+	case "Cookie":
+		return redactCookies(value)
+	case "Set-Cookie":
+		return redactSetCookie(value)
+	}
+	return redacted
+}
+
+//describeBody tells what the body is if it is only described instead of dumped, e.g. "of image/png"
+//or "encoded with gzip". Returns empty string for text bodies, which are dumped
+func describeBody(header http.Header) string {
+	if encoding := header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		return "encoded with " + encoding
+	}
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	switch {
+	case mediaType == "application/x-www-form-urlencoded",
+		mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"),
+		strings.HasPrefix(mediaType, "text/") || mediaType == "application/javascript" || mediaType == "":
+		return ""
+	}
+	return "of " + mediaType
+}
+
+//dumpBody writes text bodies with redacted form fields and json keys. Other bodies are only described
+func (t *Trace) dumpBody(dump *bytes.Buffer, header http.Header, body []byte) {
+	if len(body) == 0 {
+		return
+	}
+	dump.WriteString("\n")
+	if description := describeBody(header); description != "" {
+		fmt.Fprintf(dump, "[%d bytes %s]\n", len(body), description)
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			fmt.Fprintf(dump, "[%d bytes of malformed form data]\n", len(body))
+			return
+		}
+		dump.WriteString(t.redactForm(form).Encode())
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		var document interface{}
+		if err := json.Unmarshal(body, &document); err != nil {
+			fmt.Fprintf(dump, "[%d bytes of malformed json]\n", len(body))
+			return
+		}
+		redactedBody, _ := json.Marshal(t.redactJSON(document))
+		dump.Write(redactedBody)
+	default:
+		dump.Write(body)
+	}
+	dump.WriteString("\n")
+}
+
+func (t *Trace) redactForm(form url.Values) url.Values {
+	redactedForm := url.Values{}
+	for name, values := range form {
+		if matches(t.FormFields, name) {
+			values = []string{redacted}
+		}
+		redactedForm[name] = values
+	}
+	return redactedForm
+}
+
+func (t *Trace) redactJSON(document interface{}) interface{} {
+	switch document := document.(type) {
+	case map[string]interface{}:
+		for key, value := range document {
+			if matches(t.JSONKeys, key) {
+				document[key] = redacted
+			} else {
+				document[key] = t.redactJSON(value)
+			}
+		}
+	case []interface{}:
+		for i, value := range document {
+			document[i] = t.redactJSON(value)
+		}
+	}
+	return document
+}
+
+func matches(names []string, name string) bool {
+	for _, candidate := range names {
+		if strings.EqualFold(candidate, name) {
+			return true
+		}
+	}
+	return false
+}
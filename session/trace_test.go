@@ -0,0 +1,128 @@
+package session
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type TraceSuite struct{}
+
+var _ = Suite(&TraceSuite{})
+
+func (s *TraceSuite) TestLoginFormIsRedacted(c *C) {
+	body := url.Values{"data[User][email]": {"jan@example.com"}, "data[User][password]": {"secret"}, "remember": {"1"}}
+	request, err := Post("http://rezerwacje.duw.pl/reservations/pol/login").Form(body).Build()
+	c.Assert(err, IsNil)
+	request.Header.Set("Cookie", "CAKEPHP=session; config[lang]=pol")
+
+	dump := DefaultTrace().dumpRequest(request)
+	c.Assert(strings.Contains(dump, "jan@example.com"), Equals, false)
+	c.Assert(strings.Contains(dump, "secret"), Equals, false)
+	c.Assert(strings.Contains(dump, "session"), Equals, false)
+	c.Assert(strings.Contains(dump, "Cookie: CAKEPHP=REDACTED; config[lang]=REDACTED"), Equals, true)
+	c.Assert(strings.Contains(dump, "remember=1"), Equals, true)
+}
+
+func (s *TraceSuite) TestPersonalDataIsRedacted(c *C) {
+	body := `[{"name":"Paszport","value":"AB1234567"},{"name":"Telefon","value":"+48123456789"}]`
+	headers := Headers{"Content-Type": "application/json; charset=utf-8"}
+	request, err := Post("http://rezerwacje.duw.pl/reservations/updateFormData/1/2").Body(body).Headers(headers).Build()
+	c.Assert(err, IsNil)
+
+	dump := DefaultTrace().dumpRequest(request)
+	c.Assert(strings.Contains(dump, "AB1234567"), Equals, false)
+	c.Assert(strings.Contains(dump, "+48123456789"), Equals, false)
+	c.Assert(strings.Contains(dump, `"name":"Paszport"`), Equals, true)
+}
+
+func (s *TraceSuite) TestProfileHeadersAreDumpedInProfileOrder(c *C) {
+	profile := Profile{Name: "chrome", Headers: []Header{
+		{"sec-ch-ua-mobile", "?0"},
+		{"User-Agent", "Mozilla/5.0"},
+		{"Accept-Encoding", "gzip, deflate, br, zstd"},
+		{"Accept", "text/html"},
+	}}
+	var dump string
+	trace := roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+		dump = DefaultTrace().dumpRequest(request)
+		return nil, io.EOF
+	})
+	request, err := Get("http://rezerwacje.duw.pl/reservations/pol/queues").Headers(Headers{"Referer": "http://rezerwacje.duw.pl/"}).Build()
+	c.Assert(err, IsNil)
+
+	BrowserProfile(profile)(trace).RoundTrip(request)
+	c.Assert(dump, Equals, "GET /reservations/pol/queues HTTP/1.1\n"+
+		"Host: rezerwacje.duw.pl\n"+
+		"Sec-Ch-Ua-Mobile: ?0\n"+
+		"User-Agent: Mozilla/5.0\n"+
+		"Accept-Encoding: "+acceptedEncodings+"\n"+
+		"Accept: text/html\n"+
+		"Referer: http://rezerwacje.duw.pl/\n")
+}
+
+func (s *TraceSuite) TestHeadersOnly(c *C) {
+	response := &http.Response{
+		Proto:  "HTTP/1.1",
+		Status: "200 OK",
+		Header: http.Header{"Set-Cookie": {"CAKEPHP=session; Path=/"}, "Content-Type": {"text/html"}},
+		Body:   ioutil.NopCloser(strings.NewReader("<html>Jan Kowalski</html>")),
+	}
+	trace := DefaultTrace()
+	trace.Bodies = false
+
+	dump := trace.dumpResponse(response)
+	c.Assert(strings.Contains(dump, "Kowalski"), Equals, false)
+	c.Assert(strings.Contains(dump, "Set-Cookie: CAKEPHP=REDACTED; Path=/"), Equals, true)
+	body, _ := ioutil.ReadAll(response.Body)
+	c.Assert(string(body), Equals, "<html>Jan Kowalski</html>")
+}
+
+//untouchedBody tells whether the body was read
+type untouchedBody struct {
+	io.Reader
+	read bool
+}
+
+func (b *untouchedBody) Read(p []byte) (int, error) {
+	b.read = true
+	return b.Reader.Read(p)
+}
+
+func (b *untouchedBody) Close() error {
+	return nil
+}
+
+func (s *TraceSuite) TestBinaryBodyIsDescribedWithoutReading(c *C) {
+	body := &untouchedBody{Reader: strings.NewReader("\x89PNG\r\n")}
+	response := &http.Response{
+		Proto:         "HTTP/1.1",
+		Status:        "200 OK",
+		Header:        http.Header{"Content-Type": {"image/png"}},
+		ContentLength: 6,
+		Body:          body,
+	}
+
+	dump := DefaultTrace().dumpResponse(response)
+	c.Assert(strings.Contains(dump, "[6 bytes of image/png]"), Equals, true)
+	c.Assert(body.read, Equals, false)
+
+	response.ContentLength = -1
+	dump = DefaultTrace().dumpResponse(response)
+	c.Assert(strings.Contains(dump, "[body of unknown length of image/png]"), Equals, true)
+	c.Assert(body.read, Equals, false)
+}
+
+func (s *TraceSuite) TestHeadersOnlyDoesNotReadBody(c *C) {
+	body := &untouchedBody{Reader: strings.NewReader("<html></html>")}
+	response := &http.Response{Proto: "HTTP/1.1", Status: "200 OK", Header: http.Header{"Content-Type": {"text/html"}}, Body: body}
+	trace := DefaultTrace()
+	trace.Bodies = false
+
+	trace.dumpResponse(response)
+	c.Assert(body.read, Equals, false)
+}
@@ -0,0 +1,266 @@
+package session
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/dyrkin/rezerwacje-duw-go/log"
+)
+
+const redacted = "REDACTED"
+
+//interaction is a single request/response pair stored in a cassette file
+type interaction struct {
+	Request  recordedRequest  `json:"request"`
+	Response recordedResponse `json:"response"`
+}
+
+type recordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header"`
+	recordedBody
+}
+
+type recordedResponse struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header"`
+	recordedBody
+}
+
+//recordedBody keeps text bodies as is and binary ones, like captcha images, base64 encoded
+type recordedBody struct {
+	Body         string `json:"body"`
+	BodyEncoding string `json:"bodyEncoding,omitempty"`
+}
+
+func newRecordedBody(body []byte) recordedBody {
+	if utf8.Valid(body) {
+		return recordedBody{Body: string(body)}
+	}
+	return recordedBody{Body: base64.StdEncoding.EncodeToString(body), BodyEncoding: "base64"}
+}
+
+func (b recordedBody) bytes() ([]byte, error) {
+	if b.BodyEncoding == "base64" {
+		return base64.StdEncoding.DecodeString(b.Body)
+	}
+	return []byte(b.Body), nil
+}
+
+//recorder writes every request/response pair passed through the transport to the cassette directory
+type recorder struct {
+	transport http.RoundTripper
+	dir       string
+	sequence  int64
+}
+
+//Record makes the session write every request/response pair to the cassette directory.
+//Cookies and credentials in headers are redacted, bodies are kept
+func (s *Session) Record(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	existing, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	s.transport = &recorder{transport: s.transport, dir: dir, sequence: int64(len(existing))}
+	return nil
+}
+
+func (r *recorder) RoundTrip(request *http.Request) (*http.Response, error) {
+	requestBody, err := readRequestBody(request)
+	if err != nil {
+		return nil, err
+	}
+	response, err := r.transport.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+	responseBody, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = ioutil.NopCloser(bytes.NewReader(responseBody))
+	record := &interaction{
+		Request: recordedRequest{
+			Method:       request.Method,
+			URL:          request.URL.String(),
+			Header:       redactHeaders(request.Header),
+			recordedBody: newRecordedBody(requestBody),
+		},
+		Response: recordedResponse{
+			StatusCode:   response.StatusCode,
+			Header:       redactHeaders(response.Header),
+			recordedBody: newRecordedBody(responseBody),
+		},
+	}
+	if err := r.save(record); err != nil {
+		log.Errorf("Unable to record %s %s\n%s", request.Method, request.URL, err)
+	}
+	return response, nil
+}
+
+func (r *recorder) save(record *interaction) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	sequence := atomic.AddInt64(&r.sequence, 1)
+	name := fmt.Sprintf("%06d-%s.json", sequence, strings.ToLower(record.Request.Method))
+	return ioutil.WriteFile(filepath.Join(r.dir, name), data, 0600)
+}
+
+//replayer serves responses from the cassette directory without network access.
+//Requests are matched by method, path, query and body, then by method, path and query only.
+//Repeated requests get the recorded responses in order, the last one is repeated once they run out
+type replayer struct {
+	lock         *sync.Mutex
+	interactions map[string][]*interaction
+}
+
+//Replay makes the session serve responses from the cassette directory instead of sending requests
+func (s *Session) Replay(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no cassettes found in %q", dir)
+	}
+	sort.Strings(files)
+	r := &replayer{lock: &sync.Mutex{}, interactions: map[string][]*interaction{}}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		record := &interaction{}
+		if err := json.Unmarshal(data, record); err != nil {
+			return fmt.Errorf("malformed cassette %q: %s", file, err)
+		}
+		requestBody, err := record.Request.bytes()
+		if err != nil {
+			return fmt.Errorf("malformed cassette %q: %s", file, err)
+		}
+		request, err := http.NewRequest(record.Request.Method, record.Request.URL, nil)
+		if err != nil {
+			return fmt.Errorf("malformed cassette %q: %s", file, err)
+		}
+		for _, key := range replayKeys(request, requestBody) {
+			r.interactions[key] = append(r.interactions[key], record)
+		}
+	}
+	s.transport = r
+	return nil
+}
+
+func (r *replayer) RoundTrip(request *http.Request) (*http.Response, error) {
+	requestBody, err := readRequestBody(request)
+	if err != nil {
+		return nil, err
+	}
+	record := r.next(replayKeys(request, requestBody))
+	if record == nil {
+		return nil, fmt.Errorf("no recorded interaction for %s %s", request.Method, request.URL)
+	}
+	body, err := record.Response.bytes()
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", record.Response.StatusCode, http.StatusText(record.Response.StatusCode)),
+		StatusCode:    record.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        record.Response.Header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       request,
+	}, nil
+}
+
+func (r *replayer) next(keys []string) *interaction {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, key := range keys {
+		records := r.interactions[key]
+		if len(records) == 0 {
+			continue
+		}
+		if len(records) > 1 {
+			r.interactions[key] = records[1:]
+		}
+		return records[0]
+	}
+	return nil
+}
+
+//replayKeys returns the keys the request is matched by, the most specific first
+func replayKeys(request *http.Request, body []byte) []string {
+	target := request.Method + " " + request.URL.RequestURI()
+	return []string{target + "\n" + string(body), target}
+}
+
+//readRequestBody reads request body and puts it back so it can be sent
+func readRequestBody(request *http.Request) ([]byte, error) {
+	if request.Body == nil {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(request.Body)
+	request.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+func redactHeaders(header http.Header) http.Header {
+	redactedHeader := header.Clone()
+	for name, values := range redactedHeader {
+		for i, value := range values {
+			switch name {
+			case "Cookie":
+				values[i] = redactCookies(value)
+			case "Set-Cookie":
+				values[i] = redactSetCookie(value)
+			case "Authorization", "Proxy-Authorization":
+				values[i] = redacted
+			}
+		}
+	}
+	return redactedHeader
+}
+
+//redactCookies replaces values of Cookie header keeping cookie names
+func redactCookies(value string) string {
+	cookies := strings.Split(value, ";")
+	for i, cookie := range cookies {
+		name := strings.TrimSpace(strings.SplitN(cookie, "=", 2)[0])
+		cookies[i] = name + "=" + redacted
+	}
+	return strings.Join(cookies, "; ")
+}
+
+//redactSetCookie replaces value of Set-Cookie header keeping cookie name and attributes,
+//so replayed sessions still know which cookies were set
+func redactSetCookie(value string) string {
+	parts := strings.SplitN(value, ";", 2)
+	parts[0] = redactCookies(parts[0])
+	return strings.Join(parts, ";")
+}
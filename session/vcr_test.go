@@ -0,0 +1,62 @@
+package session
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type VCRSuite struct{}
+
+var _ = Suite(&VCRSuite{})
+
+func (s *VCRSuite) TestRecordAndReplay(c *C) {
+	captchaImage := []byte("\x89PNG\r\n\x1a\n\x00\xff")
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch r.URL.Path {
+		case "/captcha":
+			http.SetCookie(w, &http.Cookie{Name: "CAKEPHP", Value: "secret", Path: "/"})
+			w.Write(captchaImage)
+		case "/captcha/check":
+			r.ParseForm()
+			w.Write([]byte(r.PostForm.Get("code")))
+		}
+	}))
+	cassettes := c.MkDir()
+
+	recording := New()
+	c.Assert(recording.Record(cassettes), IsNil)
+	response, err := recording.SafeSend(Get(server.URL + "/captcha"))
+	c.Assert(err, IsNil)
+	c.Assert(response.AsBytes(), DeepEquals, captchaImage)
+	response, err = recording.SafeSend(Post(server.URL + "/captcha/check").Body("code=123456"))
+	c.Assert(err, IsNil)
+	c.Assert(response.AsString(), Equals, "123456")
+	server.Close()
+
+	files, _ := filepath.Glob(filepath.Join(cassettes, "*.json"))
+	c.Assert(files, HasLen, 2)
+	for _, file := range files {
+		data, _ := ioutil.ReadFile(file)
+		c.Assert(strings.Contains(string(data), "secret"), Equals, false)
+	}
+
+	replaying := New()
+	c.Assert(replaying.Replay(cassettes), IsNil)
+	response, err = replaying.SafeSend(Get(server.URL + "/captcha"))
+	c.Assert(err, IsNil)
+	c.Assert(response.AsBytes(), DeepEquals, captchaImage)
+	c.Assert(response.Header.Get("Set-Cookie"), Equals, "CAKEPHP=REDACTED; Path=/")
+	response, err = replaying.SafeSend(Post(server.URL + "/captcha/check").Body("code=654321"))
+	c.Assert(err, IsNil)
+	c.Assert(response.AsString(), Equals, "123456")
+	_, err = replaying.SafeSend(Get(server.URL + "/unknown").Retry(NoRetry()))
+	c.Assert(err, NotNil)
+	c.Assert(calls, Equals, 2)
+}
@@ -0,0 +1,208 @@
+package session
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+//ConnectionStats tells how many requests reused open connections and how long opening the new ones took
+type ConnectionStats struct {
+	Requests int
+	Reused   int
+	//Handshakes is the total time spent on DNS lookups, TCP connects and TLS handshakes of new connections
+	Handshakes time.Duration
+}
+
+//AverageHandshake returns the average time of opening a new connection
+func (cs ConnectionStats) AverageHandshake() time.Duration {
+	opened := cs.Requests - cs.Reused
+	if opened == 0 {
+		return 0
+	}
+	return cs.Handshakes / time.Duration(opened)
+}
+
+//WarmupStats tells how the requests of the session benefited from connections opened by Warm
+type WarmupStats struct {
+	//Opened is the number of connections opened by Warm
+	Opened int
+	//Handshakes is the total time spent on opening them
+	Handshakes time.Duration
+	//Reused is the number of requests sent over them
+	Reused int
+}
+
+//AverageHandshake returns the average time Warm spent on opening a connection
+func (ws WarmupStats) AverageHandshake() time.Duration {
+	if ws.Opened == 0 {
+		return 0
+	}
+	return ws.Handshakes / time.Duration(ws.Opened)
+}
+
+//Saved estimates the latency saved by requests sent over connections opened by Warm
+func (ws WarmupStats) Saved() time.Duration {
+	return time.Duration(ws.Reused) * ws.AverageHandshake()
+}
+
+//WarmupReport describes connections prepared by Warm
+type WarmupReport struct {
+	ConnectionStats
+	//Protocol is the protocol negotiated with the server, e.g. HTTP/2.0
+	Protocol string
+}
+
+//connectionTracker collects ConnectionStats of the requests
+type connectionTracker struct {
+	lock  *sync.Mutex
+	stats ConnectionStats
+}
+
+type connectionTrackerKey struct{}
+
+func newConnectionTracker() *connectionTracker {
+	return &connectionTracker{lock: &sync.Mutex{}}
+}
+
+func (t *connectionTracker) snapshot() ConnectionStats {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.stats
+}
+
+func (t *connectionTracker) record(reused bool, handshake time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.stats.Requests++
+	if reused {
+		t.stats.Reused++
+	} else {
+		t.stats.Handshakes += handshake
+	}
+}
+
+//warmupTracker remembers connections opened by Warm and counts requests which reuse them
+type warmupTracker struct {
+	lock  *sync.Mutex
+	conns map[net.Conn]bool
+	stats WarmupStats
+}
+
+func newWarmupTracker() *warmupTracker {
+	return &warmupTracker{lock: &sync.Mutex{}, conns: map[net.Conn]bool{}}
+}
+
+func (t *warmupTracker) opened(conn net.Conn, handshake time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.conns[conn] = true
+	t.stats.Opened++
+	t.stats.Handshakes += handshake
+}
+
+func (t *warmupTracker) used(conn net.Conn) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.conns[conn] {
+		t.stats.Reused++
+	}
+}
+
+func (t *warmupTracker) forget() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.conns = map[net.Conn]bool{}
+}
+
+func (t *warmupTracker) snapshot() WarmupStats {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.stats
+}
+
+//track measures how long the request waits for its connection. Requests sent by Warm are tracked separately
+//and the connections they open are remembered, so that requests reusing them are told apart
+func (s *Session) track(request *http.Request) *http.Request {
+	tracker, warming := request.Context().Value(connectionTrackerKey{}).(*connectionTracker)
+	if !warming {
+		tracker = s.connections
+	}
+	var requested time.Time
+	clientTrace := &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			requested = time.Now()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			handshake := time.Since(requested)
+			tracker.record(info.Reused, handshake)
+			switch {
+			case warming && !info.Reused:
+				s.warmup.opened(info.Conn, handshake)
+			case !warming && info.Reused:
+				s.warmup.used(info.Conn)
+			}
+		},
+	}
+	return request.WithContext(httptrace.WithClientTrace(request.Context(), clientTrace))
+}
+
+//ConnectionStats returns stats of the connections used by the requests of the session
+func (s *Session) ConnectionStats() ConnectionStats {
+	return s.connections.snapshot()
+}
+
+//WarmupStats returns stats of the requests of the session sent over connections opened by Warm
+func (s *Session) WarmupStats() WarmupStats {
+	return s.warmup.snapshot()
+}
+
+//ForgetWarmConnections forgets connections opened by Warm so far, so that they don't pile up. Call it when a new warm-up
+//window starts, the connections of the previous one are closed as idle by then. Stats are kept
+func (s *Session) ForgetWarmConnections() {
+	s.warmup.forget()
+}
+
+//Warm opens up to the given number of connections to the target at once and leaves them idle in the pool,
+//so the following requests skip TCP and TLS handshakes. Call it periodically to keep the connections open.
+//With HTTP/2 all requests share a single connection. The number is capped by 30 idle connections per host
+func (s *Session) Warm(ctx context.Context, target string, connections int) (*WarmupReport, error) {
+	tracker := newConnectionTracker()
+	ctx = context.WithValue(ctx, connectionTrackerKey{}, tracker)
+	errs := make(chan error, connections)
+	protocols := make(chan string, connections)
+	for i := 0; i < connections; i++ {
+		go func() {
+			request, err := http.NewRequestWithContext(ctx, "HEAD", target, nil)
+			if err != nil {
+				errs <- err
+				return
+			}
+			response, err := s.Do(request)
+			if err != nil {
+				errs <- err
+				return
+			}
+			(&Response{response}).Drain()
+			protocols <- response.Proto
+			errs <- nil
+		}()
+	}
+	var lastErr error
+	for i := 0; i < connections; i++ {
+		if err := <-errs; err != nil {
+			lastErr = err
+		}
+	}
+	report := &WarmupReport{ConnectionStats: tracker.snapshot()}
+	if len(protocols) > 0 {
+		report.Protocol = <-protocols
+	}
+	if report.Requests == 0 {
+		return report, lastErr
+	}
+	return report, nil
+}
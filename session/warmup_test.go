@@ -0,0 +1,96 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type WarmupSuite struct{}
+
+var _ = Suite(&WarmupSuite{})
+
+func (s *WarmupSuite) TestWarmConnectionsAreReused(c *C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	defer server.Close()
+	client := New()
+
+	report, err := client.Warm(context.Background(), server.URL, 3)
+	c.Assert(err, IsNil)
+	c.Assert(report.Requests, Equals, 3)
+	c.Assert(report.Reused < 3, Equals, true)
+	c.Assert(report.Protocol, Equals, "HTTP/1.1")
+	c.Assert(client.ConnectionStats().Requests, Equals, 0)
+
+	for i := 0; i < 3; i++ {
+		response, err := client.SafeSend(Get(server.URL))
+		c.Assert(err, IsNil)
+		response.Drain()
+	}
+	stats := client.ConnectionStats()
+	c.Assert(stats.Requests, Equals, 3)
+	c.Assert(stats.Reused, Equals, 3)
+	warmup := client.WarmupStats()
+	c.Assert(warmup.Opened, Equals, report.Requests-report.Reused)
+	c.Assert(warmup.Handshakes, Equals, report.Handshakes)
+	c.Assert(warmup.Reused, Equals, 3)
+	c.Assert(warmup.Saved() > 0, Equals, true)
+}
+
+func (s *WarmupSuite) TestKeepAliveIsNotWarmup(c *C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	defer server.Close()
+	client := New()
+
+	for i := 0; i < 3; i++ {
+		response, err := client.SafeSend(Get(server.URL))
+		c.Assert(err, IsNil)
+		response.Drain()
+	}
+	c.Assert(client.ConnectionStats().Reused, Equals, 2)
+	c.Assert(client.WarmupStats(), Equals, WarmupStats{})
+}
+
+func (s *WarmupSuite) TestForgetWarmConnections(c *C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	defer server.Close()
+	client := New()
+
+	_, err := client.Warm(context.Background(), server.URL, 2)
+	c.Assert(err, IsNil)
+	opened := client.WarmupStats()
+	c.Assert(opened.Opened > 0, Equals, true)
+	c.Assert(client.warmup.conns, HasLen, opened.Opened)
+	client.ForgetWarmConnections()
+	c.Assert(client.warmup.conns, HasLen, 0)
+
+	response, err := client.SafeSend(Get(server.URL))
+	c.Assert(err, IsNil)
+	response.Drain()
+	c.Assert(client.ConnectionStats().Reused, Equals, 1)
+	c.Assert(client.WarmupStats(), Equals, opened)
+}
+
+func (s *WarmupSuite) TestWarmUnreachableTarget(c *C) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	_, err := New().Warm(context.Background(), server.URL, 2)
+	c.Assert(err, NotNil)
+}
+
+func (s *WarmupSuite) TestSaved(c *C) {
+	stats := ConnectionStats{Requests: 4, Reused: 3, Handshakes: 40 * time.Millisecond}
+	c.Assert(stats.AverageHandshake(), Equals, 40*time.Millisecond)
+	warmup := WarmupStats{Opened: 2, Handshakes: 60 * time.Millisecond, Reused: 5}
+	c.Assert(warmup.AverageHandshake(), Equals, 30*time.Millisecond)
+	c.Assert(warmup.Saved(), Equals, 150*time.Millisecond)
+}